@@ -1,15 +1,17 @@
-package main
+package gemini
 
 import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
-const SupergraphQuery = `query SupergraphFetchQuery($graph_id: ID!, $variant: String!) {
+const SupergraphQuery = `query SupergraphFetchQuery($graph_id: ID!, $variant: String!, $composition_id: ID!, $launch_id: ID!, $pin_composition: Boolean!, $pin_launch: Boolean!) {
   frontendUrlRoot
   service(id: $graph_id) {
     variants {
@@ -22,6 +24,24 @@ const SupergraphQuery = `query SupergraphFetchQuery($graph_id: ID!, $variant: St
         graphCompositionID
       }
     }
+    pinnedComposition: compositionResultById(id: $composition_id) @include(if: $pin_composition) {
+      __typename
+      supergraphSdl
+      graphCompositionID
+    }
+    variant(name: $variant) @include(if: $pin_launch) {
+      launch(id: $launch_id) {
+        id
+        status
+        publication {
+          compositionResult {
+            __typename
+            supergraphSdl
+            graphCompositionID
+          }
+        }
+      }
+    }
     mostRecentCompositionPublish(graphVariant: $variant) {
       errors {
         message
@@ -80,28 +100,196 @@ type CompositionResult struct {
 }
 
 type SchemaTag struct {
-	CompositionResult CompositionResult `json:"compositionResult"`
+	CompositionResult *CompositionResult `json:"compositionResult"`
+}
+
+type Variant struct {
+	Name string `json:"name"`
+}
+
+type CompositionError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+type CompositionPublish struct {
+	Errors []CompositionError `json:"errors"`
+}
+
+type Launch struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Publication *SchemaTag `json:"publication"`
+}
+
+type VariantResult struct {
+	Launch *Launch `json:"launch"`
 }
 
 type ServiceResult struct {
-	SchemaTag SchemaTag `json:"schemaTag"`
+	Variants                     []Variant           `json:"variants"`
+	SchemaTag                    *SchemaTag          `json:"schemaTag"`
+	PinnedComposition            *CompositionResult  `json:"pinnedComposition"`
+	Variant                      *VariantResult      `json:"variant"`
+	MostRecentCompositionPublish *CompositionPublish `json:"mostRecentCompositionPublish"`
 }
 
 type SupergraphFetch struct {
-	FrontendURLRoot string        `json:"frontendUrlRoot"`
-	Service         ServiceResult `json:"service"`
+	FrontendURLRoot string         `json:"frontendUrlRoot"`
+	Service         *ServiceResult `json:"service"`
+}
+
+type GQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"` // field names and list indexes, e.g. ["service", "variants", 0]
+}
+
+// PathString - the error path joined with dots, e.g. service.variants.0.name.
+func (e GQLError) PathString() string {
+	segments := make([]string, 0, len(e.Path))
+	for _, segment := range e.Path {
+		segments = append(segments, fmt.Sprint(segment))
+	}
+	return strings.Join(segments, ".")
 }
 
 type SupergraphResult struct {
-	Data SupergraphFetch `json:"data"`
+	Data   SupergraphFetch `json:"data"`
+	Errors []GQLError      `json:"errors"`
+}
+
+// SupergraphPin - pin the facade to a specific composition or launch rather
+// than whatever the variant currently serves.
+type SupergraphPin struct {
+	CompositionID string
+	LaunchID      string
+	Strict        bool // refuse to start when the variant has moved past the pin
+}
+
+func (p SupergraphPin) IsSet() bool {
+	return p.CompositionID != "" || p.LaunchID != ""
+}
+
+// Composition - the composition to serve, the pinned one if a pin was
+// requested, otherwise the variant's current composition.
+func (r *SupergraphResult) Composition() *CompositionResult {
+	service := r.Data.Service
+	if service == nil {
+		return nil
+	}
+	if service.Variant != nil && service.Variant.Launch != nil {
+		if service.Variant.Launch.Publication == nil {
+			return nil
+		}
+		return service.Variant.Launch.Publication.CompositionResult
+	}
+	if service.PinnedComposition != nil {
+		return service.PinnedComposition
+	}
+	if service.SchemaTag != nil {
+		return service.SchemaTag.CompositionResult
+	}
+	return nil
+}
+
+// StudioError - the Studio API answered with GraphQL level errors.
+type StudioError struct {
+	Errors []GQLError
+}
+
+func (e *StudioError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, gqlErr := range e.Errors {
+		if len(gqlErr.Path) > 0 {
+			messages = append(messages, fmt.Sprintf("%s (at %s)", gqlErr.Message, gqlErr.PathString()))
+			continue
+		}
+		messages = append(messages, gqlErr.Message)
+	}
+	return fmt.Sprintf("studio returned errors: %s", strings.Join(messages, "; "))
+}
+
+// GraphNotFoundError - the graph ID is unknown or the key has no access to it.
+type GraphNotFoundError struct {
+	GraphID string
+}
+
+func (e *GraphNotFoundError) Error() string {
+	return fmt.Sprintf("graph %s not found or not accessible with this API key", e.GraphID)
+}
+
+// VariantNotFoundError - the graph exists but the variant does not.
+type VariantNotFoundError struct {
+	GraphID   string
+	Variant   string
+	Available []string
+}
+
+func (e *VariantNotFoundError) Error() string {
+	return fmt.Sprintf("variant %s not found on graph %s, available variants: %s",
+		e.Variant, e.GraphID, strings.Join(e.Available, ", "))
+}
+
+// CompositionFailedError - the most recent composition publish has errors
+// and there is no usable supergraph SDL.
+type CompositionFailedError struct {
+	Variant string
+	Errors  []CompositionError
+}
+
+func (e *CompositionFailedError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, compErr := range e.Errors {
+		messages = append(messages, fmt.Sprintf("[%s] %s", compErr.Code, compErr.Message))
+	}
+	return fmt.Sprintf("composition failed for variant %s: %s", e.Variant, strings.Join(messages, "; "))
+}
+
+// PinMismatchError - the pinned composition or launch could not be fetched,
+// or Studio returned a different composition than the one requested.
+type PinMismatchError struct {
+	Pinned  string
+	Fetched string
+}
+
+func (e *PinMismatchError) Error() string {
+	if e.Fetched == "" {
+		return fmt.Sprintf("pinned composition %s not found", e.Pinned)
+	}
+	return fmt.Sprintf("pinned composition %s does not match fetched composition %s", e.Pinned, e.Fetched)
 }
 
-func downloadSupergraph(graphID, variant, apiKey string) (*SupergraphResult, error) {
+// PinOutdatedError - the variant now serves a newer composition than the pin
+// and the pin is strict.
+type PinOutdatedError struct {
+	Pinned  string
+	Current string
+}
+
+func (e *PinOutdatedError) Error() string {
+	return fmt.Sprintf("variant has moved past pinned composition %s to %s", e.Pinned, e.Current)
+}
+
+// HTTPStatusError - the Studio API answered with a non-200 status.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("studio responded with HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+func downloadSupergraph(graphID, variant, apiKey string, pin SupergraphPin, logger logrus.FieldLogger) (*SupergraphResult, error) {
 
 	var q = GQLQuery{
 		Variables: map[string]interface{}{
-			"graph_id": graphID,
-			"variant":  variant,
+			"graph_id":        graphID,
+			"variant":         variant,
+			"composition_id":  pin.CompositionID,
+			"launch_id":       pin.LaunchID,
+			"pin_composition": pin.CompositionID != "" && pin.LaunchID == "",
+			"pin_launch":      pin.LaunchID != "",
 		},
 		Query:         SupergraphQuery,
 		OperationName: "SupergraphFetchQuery",
@@ -121,7 +309,7 @@ func downloadSupergraph(graphID, variant, apiKey string) (*SupergraphResult, err
 		bytes.NewBuffer(body))
 
 	if err != nil {
-		log.Errorf("Could create request %s", err)
+		logger.Errorf("Could create request %s", err)
 		return nil, fmt.Errorf("could create request %s", err)
 	}
 
@@ -135,18 +323,112 @@ func downloadSupergraph(graphID, variant, apiKey string) (*SupergraphResult, err
 	resp, err := httpClient.Do(postRequest)
 
 	if err != nil {
-		log.Errorf("Could not retrieve supergraph SDL %s", err)
+		logger.Errorf("Could not retrieve supergraph SDL %s", err)
 		return nil, fmt.Errorf("could not retrieve supergraph SDL %s", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
 	supergraphResult := &SupergraphResult{}
 
 	// Decode response
 	err = json.NewDecoder(resp.Body).Decode(supergraphResult)
 	if err != nil {
-		log.Errorf("Could not decode supergraph result: %s", err)
+		logger.Errorf("Could not decode supergraph result: %s", err)
 		return nil, fmt.Errorf("could not decode supergraph result: %s", err)
 	}
+
+	if err = checkSupergraphResult(supergraphResult, graphID, variant, pin, logger); err != nil {
+		return nil, err
+	}
 	return supergraphResult, nil
 }
+
+// checkSupergraphResult - make sure a decoded fetch actually carries a
+// supergraph SDL, otherwise report why it does not.
+func checkSupergraphResult(result *SupergraphResult, graphID, variant string, pin SupergraphPin, logger logrus.FieldLogger) error {
+
+	if len(result.Errors) > 0 {
+		return &StudioError{Errors: result.Errors}
+	}
+
+	service := result.Data.Service
+	if service == nil {
+		return &GraphNotFoundError{GraphID: graphID}
+	}
+
+	found := false
+	available := make([]string, 0, len(service.Variants))
+	for _, v := range service.Variants {
+		available = append(available, v.Name)
+		if v.Name == variant {
+			found = true
+		}
+	}
+	if !found || service.SchemaTag == nil {
+		return &VariantNotFoundError{GraphID: graphID, Variant: variant, Available: available}
+	}
+
+	if pin.IsSet() {
+		return checkPinnedComposition(result, pin, logger)
+	}
+
+	if service.MostRecentCompositionPublish != nil && len(service.MostRecentCompositionPublish.Errors) > 0 {
+		compErr := &CompositionFailedError{Variant: variant, Errors: service.MostRecentCompositionPublish.Errors}
+		if service.SchemaTag.CompositionResult == nil || service.SchemaTag.CompositionResult.SupergraphSDL == "" {
+			return compErr
+		}
+		// an older successful composition is still being served
+		logger.Warnf("Most recent composition failed, using last good supergraph: %s", compErr)
+	}
+
+	if service.SchemaTag.CompositionResult == nil || service.SchemaTag.CompositionResult.SupergraphSDL == "" {
+		return &CompositionFailedError{Variant: variant}
+	}
+
+	return nil
+}
+
+// checkPinnedComposition - verify the fetched composition is the pinned one
+// and compare it with what the variant currently serves.
+func checkPinnedComposition(result *SupergraphResult, pin SupergraphPin, logger logrus.FieldLogger) error {
+
+	service := result.Data.Service
+	pinned := pin.CompositionID
+	if pin.LaunchID != "" {
+		if service.Variant == nil || service.Variant.Launch == nil {
+			return &PinMismatchError{Pinned: "launch " + pin.LaunchID}
+		}
+		logger.Infof("Pinned launch %s has status %s", pin.LaunchID, service.Variant.Launch.Status)
+	}
+
+	composition := result.Composition()
+	if composition == nil || composition.SupergraphSDL == "" {
+		if pinned == "" {
+			pinned = "launch " + pin.LaunchID
+		}
+		return &PinMismatchError{Pinned: pinned}
+	}
+
+	if pinned == "" {
+		// launch pins resolve to whatever composition that launch published
+		pinned = composition.GraphCompositionID
+	} else if composition.GraphCompositionID != pinned {
+		return &PinMismatchError{Pinned: pinned, Fetched: composition.GraphCompositionID}
+	}
+
+	current := service.SchemaTag.CompositionResult
+	if current != nil && current.GraphCompositionID != pinned {
+		outdated := &PinOutdatedError{Pinned: pinned, Current: current.GraphCompositionID}
+		if pin.Strict {
+			return outdated
+		}
+		logger.Warnf("Serving pinned composition: %s", outdated)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCheckSupergraphResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		pin     SupergraphPin
+		want    error
+		message string
+	}{
+		{
+			name:    "studio error with list index in path",
+			body:    `{"errors":[{"message":"not allowed","path":["service","variants",0,"name"]}],"data":{"service":null}}`,
+			want:    &StudioError{},
+			message: "studio returned errors: not allowed (at service.variants.0.name)",
+		},
+		{
+			name:    "unknown graph",
+			body:    `{"data":{"service":null}}`,
+			want:    &GraphNotFoundError{},
+			message: "graph my-graph not found or not accessible with this API key",
+		},
+		{
+			name:    "unknown variant",
+			body:    `{"data":{"service":{"variants":[{"name":"current"},{"name":"staging"}],"schemaTag":null}}}`,
+			want:    &VariantNotFoundError{},
+			message: "variant prod not found on graph my-graph, available variants: current, staging",
+		},
+		{
+			name: "composition failed without a previous supergraph",
+			body: `{"data":{"service":{"variants":[{"name":"prod"}],"schemaTag":{"compositionResult":null},
+				"mostRecentCompositionPublish":{"errors":[{"message":"Field conflict","code":"INVALID_FIELD_SHARING"}]}}}}`,
+			want:    &CompositionFailedError{},
+			message: "composition failed for variant prod: [INVALID_FIELD_SHARING] Field conflict",
+		},
+		{
+			name: "composition failed with a previous supergraph",
+			body: `{"data":{"service":{"variants":[{"name":"prod"}],"schemaTag":{"compositionResult":{"supergraphSdl":"type Query { a: Int }","graphCompositionID":"c1"}},
+				"mostRecentCompositionPublish":{"errors":[{"message":"Field conflict","code":"INVALID_FIELD_SHARING"}]}}}}`,
+		},
+		{
+			name: "pinned composition differs",
+			body: `{"data":{"service":{"variants":[{"name":"prod"}],"schemaTag":{"compositionResult":{"supergraphSdl":"type Query { a: Int }","graphCompositionID":"c2"}},
+				"pinnedComposition":{"supergraphSdl":"type Query { a: Int }","graphCompositionID":"c3"}}}}`,
+			pin:     SupergraphPin{CompositionID: "c1"},
+			want:    &PinMismatchError{},
+			message: "pinned composition c1 does not match fetched composition c3",
+		},
+		{
+			name: "strict pin outdated",
+			body: `{"data":{"service":{"variants":[{"name":"prod"}],"schemaTag":{"compositionResult":{"supergraphSdl":"type Query { a: Int }","graphCompositionID":"c2"}},
+				"pinnedComposition":{"supergraphSdl":"type Query { a: Int }","graphCompositionID":"c1"}}}}`,
+			pin:     SupergraphPin{CompositionID: "c1", Strict: true},
+			want:    &PinOutdatedError{},
+			message: "variant has moved past pinned composition c1 to c2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &SupergraphResult{}
+			if err := json.Unmarshal([]byte(tt.body), result); err != nil {
+				t.Fatalf("cannot decode result: %s", err)
+			}
+			err := checkSupergraphResult(result, "my-graph", "prod", tt.pin, logrus.StandardLogger())
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected %T, got no error", tt.want)
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(tt.want) {
+				t.Fatalf("expected %T, got %T: %s", tt.want, err, err)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"github.com/joho/godotenv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jesse-apollo/gemini"
+	"github.com/jesse-apollo/gemini/ginadapter"
+)
+
+// Process exit codes, one per kind of startup failure.
+const (
+	EXIT_GENERAL           = 1
+	EXIT_SCHEMA_LOAD       = 2
+	EXIT_STUDIO_HTTP       = 3
+	EXIT_STUDIO_ERRORS     = 4
+	EXIT_GRAPH_NOT_FOUND   = 5
+	EXIT_VARIANT_NOT_FOUND = 6
+	EXIT_COMPOSITION       = 7
+	EXIT_PIN_MISMATCH      = 8
+	EXIT_PIN_OUTDATED      = 9
+	EXIT_INTROSPECTION     = 10
+	EXIT_ROUTE_COLLISION   = 11
+	EXIT_LINT              = 12
+	EXIT_BREAKING          = 13
+	EXIT_LOCK_DRIFT        = 14
+)
+
+func init() {
+	// Log as JSON instead of the default ASCII formatter.
+	//log.SetFormatter(&log.JSONFormatter{})
+
+	log.SetFormatter(&log.TextFormatter{
+		DisableColors: false,
+		FullTimestamp: false,
+	})
+
+	// Output to stdout instead of the default stderr
+	// Can be any io.Writer, see below for File example
+	log.SetOutput(os.Stdout)
+
+	// Only log the warning severity or above.
+	log.SetLevel(log.TraceLevel)
+}
+
+func main() {
+
+	godotenv.Load()
+
+	// commands other than serving routes, e.g. gemini coverage -schema test.graphqls
+	command := ""
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "", "serve":
+	case "coverage", "lint", "diff", "lock":
+		// keep the report readable, logs go to stderr
+		log.SetOutput(os.Stderr)
+		log.SetLevel(log.WarnLevel)
+	default:
+		log.Errorf("Unknown command %s, expected serve, coverage, lint, diff or lock", command)
+		os.Exit(EXIT_GENERAL)
+	}
+
+	localSchema := ""
+	schemaCache := ""
+	introspectURL := ""
+	introspectHeaders := gemini.HeaderFlags{}
+	dryRun := false
+	contractSpec := os.Getenv("GEMINI_CONTRACT")
+	pluralSpec := os.Getenv("GEMINI_PLURALS")
+	separateResources := false
+	pathKeySpec := os.Getenv("GEMINI_PATH_KEYS")
+	listModeSpec := os.Getenv("GEMINI_LIST_MODES")
+	upstreamURL := os.Getenv("GEMINI_UPSTREAM_URL")
+	upstreamHeaders := gemini.HeaderFlags{}
+	maxDepth, _ := strconv.Atoi(os.Getenv("GEMINI_MAX_DEPTH"))
+	rootDepthSpec := os.Getenv("GEMINI_ROOT_DEPTH")
+	collisionStrategy := os.Getenv("GEMINI_ROUTE_COLLISIONS")
+	strictRoutes := os.Getenv("GEMINI_STRICT_ROUTES") == "true"
+	renameSpec := os.Getenv("GEMINI_ROUTE_RENAMES")
+	aliasSpec := os.Getenv("GEMINI_ROUTE_ALIASES")
+	sunsetSpec := os.Getenv("GEMINI_SUNSETS")
+	deprecationDocs := os.Getenv("GEMINI_DEPRECATION_DOCS")
+	lockPath := os.Getenv("GEMINI_LOCKFILE")
+	tenantsPath := os.Getenv("GEMINI_TENANTS")
+	mountsPath := os.Getenv("GEMINI_MOUNTS")
+	lockDrift := os.Getenv("GEMINI_LOCK_DRIFT")
+	if lockDrift == "" {
+		lockDrift = gemini.LOCK_DRIFT_FAIL
+	}
+	updateLock := false
+	outputFormat := "text"
+	pin := gemini.SupergraphPin{
+		CompositionID: os.Getenv("APOLLO_COMPOSITION_ID"),
+		LaunchID:      os.Getenv("APOLLO_LAUNCH_ID"),
+		Strict:        os.Getenv("GEMINI_PIN_STRICT") == "true",
+	}
+
+	flag.StringVar(&localSchema, "schema", "", "Load schema from a file, directory, glob or HTTP(S) URL instead of Studio.")
+	flag.StringVar(&schemaCache, "schema-cache", defaultSchemaCacheDir(), "Directory used to cache schemas fetched by URL.")
+	flag.StringVar(&introspectURL, "introspect", "", "Load schema by introspecting a running GraphQL endpoint.")
+	flag.Var(&introspectHeaders, "introspect-header", "Header sent with the introspection query, 'Name: value' (repeatable).")
+	flag.BoolVar(&dryRun, "dry", false, "Dry run route creation.")
+	flag.StringVar(&contractSpec, "contract", contractSpec, "Only publish fields with these @tag names, prefix with ! to exclude, e.g. 'public,!internal' (GEMINI_CONTRACT).")
+	flag.StringVar(&pin.CompositionID, "composition-id", pin.CompositionID, "Pin to a graph composition ID (APOLLO_COMPOSITION_ID).")
+	flag.StringVar(&pin.LaunchID, "launch-id", pin.LaunchID, "Pin to the composition published by a launch (APOLLO_LAUNCH_ID).")
+	flag.StringVar(&pluralSpec, "plurals", pluralSpec, "Irregular plurals for resource names, e.g. 'person:people,child:children' (GEMINI_PLURALS).")
+	flag.BoolVar(&separateResources, "separate-resources", false, "Don't merge item root fields into their collection, e.g. keep /author/:id next to /authors.")
+	flag.StringVar(&pathKeySpec, "path-keys", pathKeySpec, "Extra arguments encoded into the path, 'arg' or 'field.arg', e.g. 'login,book.isbn' (GEMINI_PATH_KEYS).")
+	flag.StringVar(&listModeSpec, "list-modes", listModeSpec, "How routes go through list fields, e.g. '/books=key:isbn,/authors=index', default flatten (GEMINI_LIST_MODES).")
+	flag.IntVar(&maxDepth, "max-depth", maxDepth, fmt.Sprintf("Nested fields followed below a root field, default %d (GEMINI_MAX_DEPTH).", gemini.MAX_PATH_DEPTH))
+	flag.StringVar(&rootDepthSpec, "root-depth", rootDepthSpec, "Depth for single root fields, e.g. 'repository=5,viewer=2' (GEMINI_ROOT_DEPTH).")
+	flag.StringVar(&collisionStrategy, "route-collisions", collisionStrategy, "Resolve route collisions with prefer-root (drop) or suffix (move to /path_2) (GEMINI_ROUTE_COLLISIONS).")
+	flag.BoolVar(&strictRoutes, "strict-routes", strictRoutes, "Refuse to start when routes collide (GEMINI_STRICT_ROUTES).")
+	flag.StringVar(&renameSpec, "route-renames", renameSpec, "Path segment for fields, e.g. 'Query.findAuthors=search,Vault.goodies=treats' (GEMINI_ROUTE_RENAMES).")
+	flag.StringVar(&aliasSpec, "route-aliases", aliasSpec, "Old paths of renamed routes, served as deprecated, e.g. '/old/path=/new/path' (GEMINI_ROUTE_ALIASES).")
+	flag.StringVar(&sunsetSpec, "sunsets", sunsetSpec, "Sunset dates of deprecated fields and aliases, e.g. 'Award.title=2027-01-31,*=2027-06-30' (GEMINI_SUNSETS).")
+	flag.StringVar(&deprecationDocs, "deprecation-docs", deprecationDocs, "Documentation URL linked from Deprecation headers, the field is added as fragment (GEMINI_DEPRECATION_DOCS).")
+	flag.StringVar(&mountsPath, "mounts", mountsPath, "JSON config of prefixes, e.g. API versions or separate graphs, each served from its own schema (GEMINI_MOUNTS).")
+	flag.StringVar(&tenantsPath, "tenants", tenantsPath, "JSON config picking the upstream per tenant from a header, subdomain or path segment (GEMINI_TENANTS).")
+	flag.StringVar(&lockPath, "lockfile", lockPath, fmt.Sprintf("Route lockfile checked on startup, the lock command defaults to %s (GEMINI_LOCKFILE).", gemini.DEFAULT_LOCKFILE))
+	flag.StringVar(&lockDrift, "lock-drift", lockDrift, "When routes drift from the lockfile: fail, keep (serve moved routes at their locked path) or warn (GEMINI_LOCK_DRIFT).")
+	flag.BoolVar(&updateLock, "update", false, "Let the lock command overwrite a lockfile with breaking changes.")
+	flag.StringVar(&outputFormat, "format", outputFormat, "Output of the lint (text, sarif) and diff (text, json) commands.")
+	flag.StringVar(&upstreamURL, "upstream", upstreamURL, "GraphQL endpoint to send requests to, without it routes return the GraphQL request (GEMINI_UPSTREAM_URL).")
+	flag.Var(&upstreamHeaders, "upstream-header", "Header sent with upstream requests, 'Name: value' (repeatable).")
+	flag.BoolVar(&pin.Strict, "pin-strict", pin.Strict, "Refuse to start if the variant has moved past the pin (GEMINI_PIN_STRICT).")
+	flag.CommandLine.Parse(args)
+
+	var err error
+	var tenants *gemini.Tenants
+	if tenantsPath != "" {
+		tenants, err = gemini.ReadTenants(tenantsPath)
+		if err != nil {
+			log.Error(err)
+			os.Exit(EXIT_GENERAL)
+		}
+	}
+	routeOpts := &gemini.RouteOptions{
+		SeparateResources: separateResources,
+		PathKeys:          make(map[string]bool),
+	}
+	for _, pathKey := range strings.Split(pathKeySpec, ",") {
+		if pathKey = strings.TrimSpace(pathKey); pathKey != "" {
+			routeOpts.PathKeys[pathKey] = true
+		}
+	}
+	switch collisionStrategy {
+	case "", gemini.COLLISION_PREFER_ROOT, gemini.COLLISION_SUFFIX:
+	default:
+		log.Errorf("Unknown route collision strategy %s", collisionStrategy)
+		os.Exit(EXIT_GENERAL)
+	}
+	if lockDrift != gemini.LOCK_DRIFT_FAIL && lockDrift != gemini.LOCK_DRIFT_KEEP && lockDrift != gemini.LOCK_DRIFT_WARN {
+		log.Errorf("Unknown lock drift mode %s, expected fail, keep or warn", lockDrift)
+		os.Exit(EXIT_GENERAL)
+	}
+	routeOpts.Collisions = collisionStrategy
+	routeOpts.StrictRoutes = strictRoutes
+	routeOpts.Renames, err = gemini.ParseRouteRenames(renameSpec)
+	if err != nil {
+		log.Errorf("Invalid route renames: %s", err)
+		os.Exit(EXIT_GENERAL)
+	}
+	routeOpts.Aliases, err = gemini.ParseRouteAliases(aliasSpec)
+	if err != nil {
+		log.Error(err)
+		os.Exit(EXIT_GENERAL)
+	}
+	routeOpts.Deprecations = &gemini.DeprecationOptions{Docs: deprecationDocs}
+	routeOpts.Deprecations.Sunsets, err = gemini.ParseSunsets(sunsetSpec)
+	if err != nil {
+		log.Error(err)
+		os.Exit(EXIT_GENERAL)
+	}
+	routeOpts.Traversal = &gemini.Traversal{MaxDepth: maxDepth}
+	routeOpts.Traversal.RootDepth, err = gemini.ParseDepthOverrides(rootDepthSpec)
+	if err != nil {
+		log.Errorf("Invalid root depths: %s", err)
+		os.Exit(EXIT_GENERAL)
+	}
+	routeOpts.ListModes, err = gemini.ParseListModes(listModeSpec)
+	if err != nil {
+		log.Errorf("Invalid list modes: %s", err)
+		os.Exit(EXIT_GENERAL)
+	}
+	if pluralSpec != "" {
+		routeOpts.Inflector, err = gemini.ParseInflector(pluralSpec)
+		if err != nil {
+			log.Errorf("Invalid plural rules: %s", err)
+			os.Exit(EXIT_GENERAL)
+		}
+	}
+	if contractSpec != "" {
+		routeOpts.Contract, err = gemini.ParseContract(contractSpec)
+		if err != nil {
+			log.Errorf("Invalid contract: %s", err)
+			os.Exit(EXIT_GENERAL)
+		}
+		log.Infof("Applying contract %s", routeOpts.Contract)
+	}
+
+	if command == "diff" {
+		if flag.NArg() != 2 {
+			log.Errorf("Usage: gemini diff [flags] old.graphqls new.graphqls")
+			os.Exit(EXIT_GENERAL)
+		}
+		surfaces := make([][]gemini.RouteSpec, 0, 2)
+		for _, location := range flag.Args() {
+			schema := loadSchema(gemini.NewLocalSchemaSource(location, schemaCache, log.StandardLogger()))
+			opts := *routeOpts
+			opts.Traversal = &gemini.Traversal{MaxDepth: maxDepth, RootDepth: routeOpts.Traversal.RootDepth}
+			routeMap, err := gemini.CreateRouteMap(schema, &opts)
+			if err != nil {
+				log.Errorf("Cannot build routes for %s: %s", location, err)
+				os.Exit(EXIT_ROUTE_COLLISION)
+			}
+			surfaces = append(surfaces, gemini.BuildSurface(routeMap))
+		}
+		changes := gemini.DiffSurfaces(surfaces[0], surfaces[1])
+		if outputFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(changes)
+		} else {
+			gemini.WriteChanges(os.Stdout, changes)
+		}
+		if gemini.HasBreaking(changes) {
+			os.Exit(EXIT_BREAKING)
+		}
+		return
+	}
+
+	if mountsPath != "" {
+		if command != "" && command != "serve" {
+			log.Errorf("-mounts only applies to serving, run %s with -schema for each mount", command)
+			os.Exit(EXIT_GENERAL)
+		}
+		mounts, err := gemini.ReadMounts(mountsPath)
+		if err != nil {
+			log.Error(err)
+			os.Exit(EXIT_GENERAL)
+		}
+		shared := gemini.NewUpstream(upstreamURL, upstreamHeaders.Header())
+		handlers := make([]*gemini.Handler, 0, len(mounts))
+		for _, mount := range mounts {
+			source, err := mount.Source(schemaCache, os.Getenv("APOLLO_KEY"), os.Getenv("APOLLO_GRAPH_REF"), pin.Strict, log.StandardLogger())
+			if err != nil {
+				log.Error(err)
+				os.Exit(EXIT_GENERAL)
+			}
+			opts, err := mount.RouteOptions(routeOpts)
+			if err != nil {
+				log.Error(err)
+				os.Exit(EXIT_GENERAL)
+			}
+			schema := loadSchema(source)
+			mountMap, err := gemini.CreateRouteMap(schema, opts)
+			if err != nil {
+				log.Errorf("Cannot build routes for %s: %s", mount.Prefix, err)
+				os.Exit(EXIT_ROUTE_COLLISION)
+			}
+			checkLockfile(mountMap, mount.Lockfile, lockDrift)
+			logMutations(schema, opts, mount.Prefix)
+			upstream := mount.NewUpstream(shared)
+			handlers = append(handlers, gemini.NewRouteHandler(gemini.MountRoutes(mountMap, mount.Prefix), upstream, tenants))
+			log.Infof("Serving %d routes under %s from %s", len(mountMap), mount.Prefix, source.Name())
+			if upstream != nil {
+				log.Infof("  upstream %s", upstream.URL)
+			}
+		}
+		serveRoutes(handlers, dryRun)
+		return
+	}
+
+	var source gemini.SchemaSource
+
+	if introspectURL != "" {
+		source = &gemini.IntrospectionSource{URL: introspectURL, Headers: introspectHeaders.Header()}
+	} else if localSchema != "" {
+		source = gemini.NewLocalSchemaSource(localSchema, schemaCache, log.StandardLogger())
+	} else {
+		apiKey := os.Getenv("APOLLO_KEY")
+		graphRef := os.Getenv("APOLLO_GRAPH_REF")
+		graphRefParts := strings.Split(graphRef, "@")
+
+		log.Debug("Uplink ref is: ", graphRef)
+
+		if len(graphRefParts) != 2 {
+			log.Errorf("Could not decode graph ref: %s", graphRef)
+			return
+		}
+		source = &gemini.StudioSource{
+			GraphID: graphRefParts[0],
+			Variant: graphRefParts[1],
+			APIKey:  apiKey,
+			Pin:     pin,
+		}
+	}
+
+	// parse schema from Uplink, disk or a remote endpoint
+	ast := loadSchema(source)
+
+	if command == "lint" {
+		diagnostics := gemini.Lint(ast, routeOpts)
+		if outputFormat == "sarif" {
+			err = gemini.WriteLintSARIF(os.Stdout, diagnostics)
+		} else {
+			gemini.WriteLintText(os.Stdout, diagnostics)
+		}
+		if err != nil || diagnostics.HasErrors() {
+			os.Exit(EXIT_LINT)
+		}
+		return
+	}
+
+	routeMap, err := gemini.CreateRouteMap(ast, routeOpts)
+	if err != nil {
+		log.Errorf("Cannot build routes: %s", err)
+		os.Exit(EXIT_ROUTE_COLLISION)
+	}
+
+	if command == "coverage" {
+		gemini.WriteCoverage(os.Stdout, gemini.CheckCoverage(ast, routeMap, routeOpts))
+		return
+	}
+
+	if command == "lock" {
+		if lockPath == "" {
+			lockPath = gemini.DEFAULT_LOCKFILE
+		}
+		lock, err := gemini.ReadLockfile(lockPath)
+		if err != nil {
+			log.Error(err)
+			os.Exit(EXIT_GENERAL)
+		}
+		surface := gemini.BuildSurface(routeMap)
+		if lock != nil {
+			changes := gemini.DiffSurfaces(lock.Routes, surface)
+			if len(changes) == 0 {
+				fmt.Printf("%s is up to date\n", lockPath)
+				return
+			}
+			gemini.WriteChanges(os.Stdout, changes)
+			if gemini.HasBreaking(changes) && !updateLock {
+				log.Errorf("Breaking route changes, not updating %s without -update", lockPath)
+				os.Exit(EXIT_LOCK_DRIFT)
+			}
+		}
+		if err := gemini.WriteLockfile(lockPath, surface); err != nil {
+			log.Error(err)
+			os.Exit(EXIT_GENERAL)
+		}
+		fmt.Printf("Wrote %d routes to %s\n", len(surface), lockPath)
+		return
+	}
+
+	checkLockfile(routeMap, lockPath, lockDrift)
+	logMutations(ast, routeOpts, "")
+
+	handler := gemini.NewRouteHandler(routeMap, gemini.NewUpstream(upstreamURL, upstreamHeaders.Header()), tenants)
+	serveRoutes([]*gemini.Handler{handler}, dryRun)
+}
+
+// checkLockfile - compare routes with a lockfile, exits on drift that can't
+// be served.
+func checkLockfile(routeMap map[string]*gemini.GetMethod, lockPath, lockDrift string) {
+	if lockPath == "" {
+		return
+	}
+	lock, err := gemini.ReadLockfile(lockPath)
+	if err != nil {
+		log.Error(err)
+		os.Exit(EXIT_GENERAL)
+	}
+	if lock == nil {
+		log.Warnf("Lockfile %s not found, run gemini lock to create it", lockPath)
+	} else if err := gemini.ApplyLockfile(routeMap, lock, lockPath, lockDrift, log.StandardLogger()); err != nil {
+		log.Error(err)
+		os.Exit(EXIT_LOCK_DRIFT)
+	}
+}
+
+// logMutations - list the mutations, they take their variables as JSON body.
+func logMutations(schema *ast.Schema, opts *gemini.RouteOptions, prefix string) {
+	if schema.Mutation == nil {
+		return
+	}
+	for _, thing := range schema.Mutation.Fields {
+		if gemini.IsHiddenField(thing, schema) || !opts.Contract.FieldAllowed(schema.Mutation.Name, thing, schema) {
+			continue
+		}
+		log.Infof("%s - POST %s/%s", thing.Name, prefix, gemini.ToSnakeCase(thing.Name))
+	}
+}
+
+// serveRoutes - register the routes of every handler and start the server.
+func serveRoutes(handlers []*gemini.Handler, dryRun bool) {
+	router := gin.Default()
+
+	for _, handler := range handlers {
+		ginadapter.Register(router, handler)
+	}
+
+	if !dryRun {
+		router.Run()
+	}
+}
+
+// loadSchema - load and parse a schema, exits when it can't.
+func loadSchema(source gemini.SchemaSource) *ast.Schema {
+	schema, err := gemini.LoadSchema(source)
+	var parseErr *gemini.SchemaParseError
+	if errors.As(err, &parseErr) {
+		fmt.Printf("Load schema error: %s\n", parseErr.Err)
+		os.Exit(EXIT_SCHEMA_LOAD)
+	}
+	if err != nil {
+		log.Errorf("Cannot load schema from %s: %s", source.Name(), err)
+		os.Exit(schemaSourceExitCode(err))
+	}
+	return schema
+}
+
+// defaultSchemaCacheDir - per user cache directory, empty disables caching.
+func defaultSchemaCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gemini")
+}
+
+// schemaSourceExitCode - map a schema source failure to a process exit code.
+func schemaSourceExitCode(err error) int {
+	var introspectionErr *gemini.IntrospectionError
+	if errors.As(err, &introspectionErr) {
+		return EXIT_INTROSPECTION
+	}
+	return supergraphExitCode(err)
+}
+
+// supergraphExitCode - map a supergraph fetch failure to a process exit code.
+func supergraphExitCode(err error) int {
+	var httpErr *gemini.HTTPStatusError
+	var studioErr *gemini.StudioError
+	var graphErr *gemini.GraphNotFoundError
+	var variantErr *gemini.VariantNotFoundError
+	var compErr *gemini.CompositionFailedError
+	var mismatchErr *gemini.PinMismatchError
+	var outdatedErr *gemini.PinOutdatedError
+
+	switch {
+	case errors.As(err, &httpErr):
+		return EXIT_STUDIO_HTTP
+	case errors.As(err, &studioErr):
+		return EXIT_STUDIO_ERRORS
+	case errors.As(err, &graphErr):
+		return EXIT_GRAPH_NOT_FOUND
+	case errors.As(err, &variantErr):
+		return EXIT_VARIANT_NOT_FOUND
+	case errors.As(err, &compErr):
+		return EXIT_COMPOSITION
+	case errors.As(err, &mismatchErr):
+		return EXIT_PIN_MISMATCH
+	case errors.As(err, &outdatedErr):
+		return EXIT_PIN_OUTDATED
+	}
+	return EXIT_GENERAL
+}
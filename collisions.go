@@ -0,0 +1,242 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	COLLISION_PREFER_ROOT = "prefer-root" // keep the route closest to the root, drop the others
+	COLLISION_SUFFIX      = "suffix"      // keep every route, move later ones to e.g. /library_2/...
+)
+
+// RouteCollision - two routes the router can't serve side by side, either
+// the same path or differently named params at the same position, e.g.
+// /authors/:author_id and /authors/:authors_index/books.
+type RouteCollision struct {
+	Path       string // route that lost
+	Field      string
+	Existing   string // route it collided with
+	ExistField string
+	Resolution string // new path, or empty when dropped
+}
+
+func (c RouteCollision) String() string {
+	kind := "same path"
+	if c.Path != c.Existing {
+		kind = "conflicting path params"
+	}
+	resolution := "dropped"
+	if c.Resolution != "" {
+		resolution = "moved to " + c.Resolution
+	}
+	return fmt.Sprintf("%s (%s) collides with %s (%s), %s: %s", c.Path, c.Field, c.Existing, c.ExistField, kind, resolution)
+}
+
+// RouteCollisionError - collisions found with RouteOptions.StrictRoutes.
+type RouteCollisionError struct {
+	Collisions []RouteCollision
+}
+
+func (e *RouteCollisionError) Error() string {
+	lines := make([]string, 0, len(e.Collisions))
+	for _, collision := range e.Collisions {
+		lines = append(lines, collision.String())
+	}
+	return fmt.Sprintf("%d route collisions:\n  %s", len(e.Collisions), strings.Join(lines, "\n  "))
+}
+
+// Coordinate - the schema field a route serves, e.g. Vault.goodies, or the
+// entity type for _entities routes.
+func (m *GetMethod) Coordinate() string {
+	if m.Entity != nil && m.Entity.RootField == "" {
+		return m.Entity.TypeName + " @key(" + m.Entity.Key + ")"
+	}
+	parentType := "Query"
+	if len(m.FieldPath) > 0 {
+		parentType = m.FieldPath[len(m.FieldPath)-1].Type
+	}
+	return parentType + "." + m.OriginalField
+}
+
+// routeNode - one path segment in the router's view of the routes.
+type routeNode struct {
+	static map[string]*routeNode
+	param  string
+	child  *routeNode
+	owner  *GetMethod // route that introduced param, or that ends here
+	route  *GetMethod
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{static: make(map[string]*routeNode)}
+}
+
+// find - the route that collides with segments, and the index of the
+// segment where they collide. Nil when the path can be added.
+func (n *routeNode) find(segments []string) (*GetMethod, int) {
+	node := n
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			if node.child == nil {
+				return nil, -1
+			}
+			if node.param != segment {
+				return node.owner, i
+			}
+			node = node.child
+			continue
+		}
+		next, ok := node.static[segment]
+		if !ok {
+			return nil, -1
+		}
+		node = next
+	}
+	if node.route != nil {
+		return node.route, len(segments)
+	}
+	return nil, -1
+}
+
+// match - the route serving a request path, static segments are tried
+// before path params like the router does. Path params of the route are
+// added to params.
+func (n *routeNode) match(segments []string, params map[string]string) *GetMethod {
+	if len(segments) == 0 {
+		return n.route
+	}
+	if next, ok := n.static[segments[0]]; ok {
+		if route := next.match(segments[1:], params); route != nil {
+			return route
+		}
+	}
+	if n.child != nil && segments[0] != "" {
+		if route := n.child.match(segments[1:], params); route != nil {
+			params[strings.TrimPrefix(n.param, ":")] = segments[0]
+			return route
+		}
+	}
+	return nil
+}
+
+func (n *routeNode) add(segments []string, method *GetMethod) {
+	node := n
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			if node.child == nil {
+				node.param = segment
+				node.owner = method
+				node.child = newRouteNode()
+			}
+			node = node.child
+			continue
+		}
+		next, ok := node.static[segment]
+		if !ok {
+			next = newRouteNode()
+			node.static[segment] = next
+		}
+		node = next
+	}
+	node.route = method
+}
+
+// routePriority - routes closer to the root win, then schema routes over
+// entity routes, then the path itself so the result is always the same.
+func routePriority(sigs []*GetMethod) {
+	sort.SliceStable(sigs, func(i, j int) bool {
+		a, b := sigs[i], sigs[j]
+		if len(a.FieldPath) != len(b.FieldPath) {
+			return len(a.FieldPath) < len(b.FieldPath)
+		}
+		if (a.Entity == nil) != (b.Entity == nil) {
+			return a.Entity == nil
+		}
+		if da, db := strings.Count(a.Path, "/"), strings.Count(b.Path, "/"); da != db {
+			return da < db
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Coordinate() < b.Coordinate()
+	})
+}
+
+// suffixedPath - move a path out of the way of a collision at segment index
+// at by suffixing the static segment before it, /authors -> /authors_2.
+func suffixedPath(segments []string, at, n int) []string {
+	moved := append([]string{}, segments...)
+	for i := at - 1; i >= 0; i-- {
+		if i < len(moved) && !strings.HasPrefix(moved[i], ":") {
+			moved[i] = fmt.Sprintf("%s_%d", segments[i], n)
+			return moved
+		}
+	}
+	return nil
+}
+
+// ResolveCollisions - build the route map from every generated route,
+// resolving collisions with the given strategy. Routes are placed in
+// priority order, so the same schema always resolves the same way.
+func ResolveCollisions(sigs []*GetMethod, strategy string) (map[string]*GetMethod, []RouteCollision) {
+	routeMap := make(map[string]*GetMethod, len(sigs))
+	collisions := make([]RouteCollision, 0)
+
+	ordered := append([]*GetMethod{}, sigs...)
+	routePriority(ordered)
+
+	root := newRouteNode()
+	for _, sig := range ordered {
+		segments := strings.Split(strings.TrimPrefix(sig.Path, "/"), "/")
+		existing, at := root.find(segments)
+		if existing == nil {
+			root.add(segments, sig)
+			routeMap[sig.Path] = sig
+			continue
+		}
+
+		collision := RouteCollision{
+			Path:       sig.Path,
+			Field:      sig.Coordinate(),
+			Existing:   existing.Path,
+			ExistField: existing.Coordinate(),
+		}
+		if strategy == COLLISION_SUFFIX {
+			for n := 2; n < 100; n++ {
+				moved := suffixedPath(segments, at, n)
+				if moved == nil {
+					break
+				}
+				if blocker, _ := root.find(moved); blocker == nil {
+					sig.Path = "/" + strings.Join(moved, "/")
+					root.add(moved, sig)
+					routeMap[sig.Path] = sig
+					collision.Resolution = sig.Path
+					break
+				}
+			}
+		}
+		collisions = append(collisions, collision)
+	}
+	return routeMap, collisions
+}
+
+// ParseRouteRenames - parse path segment renames for fields, e.g.
+// "Query.findAuthors=search,Vault.goodies=treats".
+func ParseRouteRenames(spec string) (map[string]string, error) {
+	renames := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], ".") || parts[1] == "" || strings.ContainsAny(parts[1], "/:") {
+			return nil, fmt.Errorf("route rename must be in the form Type.field=segment, got %s", item)
+		}
+		renames[parts[0]] = parts[1]
+	}
+	return renames, nil
+}
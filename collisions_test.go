@@ -0,0 +1,166 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+)
+
+// testMethod - a route for field on Query, or below the path of fields.
+func testMethod(path, field string, fieldPath ...string) *GetMethod {
+	method := &GetMethod{Path: path, OriginalField: field}
+	parentType := "Query"
+	for _, item := range fieldPath {
+		method.FieldPath = append(method.FieldPath, FieldPathDetail{Path: item, FieldKey: parentType + "." + item + "()", Type: strings.Title(item)})
+		parentType = strings.Title(item)
+	}
+	return method
+}
+
+func TestResolveCollisions(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		sigs       []*GetMethod
+		routes     []string
+		collisions []string
+	}{
+		{
+			name:     "no collisions",
+			strategy: COLLISION_PREFER_ROOT,
+			sigs: []*GetMethod{
+				testMethod("/authors", "authors"),
+				testMethod("/authors/:author_id", "author"),
+				testMethod("/authors/:author_id/books", "books", "author"),
+			},
+			routes: []string{"/authors", "/authors/:author_id", "/authors/:author_id/books"},
+		},
+		{
+			name:     "same path, root wins",
+			strategy: COLLISION_PREFER_ROOT,
+			sigs: []*GetMethod{
+				testMethod("/library/books", "books", "library", "vault"),
+				testMethod("/library/books", "books", "library"),
+			},
+			routes:     []string{"/library/books"},
+			collisions: []string{"/library/books (Vault.books) collides with /library/books (Library.books), same path: dropped"},
+		},
+		{
+			name:     "conflicting params, root wins",
+			strategy: COLLISION_PREFER_ROOT,
+			sigs: []*GetMethod{
+				testMethod("/authors/:authors_index/books", "books", "authors"),
+				testMethod("/authors/:author_id", "author"),
+			},
+			routes:     []string{"/authors/:author_id"},
+			collisions: []string{"/authors/:authors_index/books (Authors.books) collides with /authors/:author_id (Query.author), conflicting path params: dropped"},
+		},
+		{
+			name:     "conflicting params, suffixed",
+			strategy: COLLISION_SUFFIX,
+			sigs: []*GetMethod{
+				testMethod("/authors/:authors_index/books", "books", "authors"),
+				testMethod("/authors/:author_id", "author"),
+			},
+			routes:     []string{"/authors/:author_id", "/authors_2/:authors_index/books"},
+			collisions: []string{"/authors/:authors_index/books (Authors.books) collides with /authors/:author_id (Query.author), conflicting path params: moved to /authors_2/:authors_index/books"},
+		},
+		{
+			name:     "suffix skips taken paths",
+			strategy: COLLISION_SUFFIX,
+			sigs: []*GetMethod{
+				testMethod("/library/books", "books", "library"),
+				testMethod("/library/books_2", "books2", "library"),
+				testMethod("/library/books", "books", "library", "vault"),
+			},
+			routes: []string{"/library/books", "/library/books_2", "/library/books_3"},
+			collisions: []string{
+				"/library/books (Vault.books) collides with /library/books (Library.books), same path: moved to /library/books_3",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeMap, collisions := ResolveCollisions(tt.sigs, tt.strategy)
+			if len(routeMap) != len(tt.routes) {
+				t.Errorf("expected routes %v, got %d", tt.routes, len(routeMap))
+			}
+			for _, path := range tt.routes {
+				if routeMap[path] == nil {
+					t.Errorf("missing route %s", path)
+				}
+			}
+			if len(collisions) != len(tt.collisions) {
+				t.Fatalf("expected collisions %v, got %v", tt.collisions, collisions)
+			}
+			for i, collision := range collisions {
+				if collision.String() != tt.collisions[i] {
+					t.Errorf("expected %q, got %q", tt.collisions[i], collision.String())
+				}
+			}
+		})
+	}
+}
+
+func TestResolveCollisionsOrder(t *testing.T) {
+	// the same routes in any order resolve the same way
+	sigs := []*GetMethod{
+		testMethod("/library/books", "books", "library", "vault"),
+		testMethod("/library/books", "books", "library"),
+		testMethod("/library/books", "books", "library", "annex"),
+	}
+	for i := 0; i < len(sigs); i++ {
+		rotated := append(append([]*GetMethod{}, sigs[i:]...), sigs[:i]...)
+		routeMap, _ := ResolveCollisions(rotated, COLLISION_PREFER_ROOT)
+		if winner := routeMap["/library/books"]; winner != sigs[1] {
+			t.Errorf("rotation %d: expected Library.books to win, got %s", i, winner.Coordinate())
+		}
+	}
+}
+
+func TestRouteNodeMatch(t *testing.T) {
+	routeMap := map[string]*GetMethod{
+		"/authors":                  testMethod("/authors", "authors"),
+		"/authors/search":           testMethod("/authors/search", "search"),
+		"/authors/:author_id":       testMethod("/authors/:author_id", "author"),
+		"/authors/:author_id/books": testMethod("/authors/:author_id/books", "books", "author"),
+	}
+	root := routeTrie(routeMap)
+
+	tests := []struct {
+		path   string
+		route  string
+		params map[string]string
+	}{
+		{"/authors", "/authors", map[string]string{}},
+		{"/authors/search", "/authors/search", map[string]string{}},
+		{"/authors/42", "/authors/:author_id", map[string]string{"author_id": "42"}},
+		{"/authors/search/books", "/authors/:author_id/books", map[string]string{"author_id": "search"}},
+		{"/authors/", "", nil},
+		{"/authors/42/awards", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			params := make(map[string]string)
+			route := root.match(strings.Split(strings.TrimPrefix(tt.path, "/"), "/"), params)
+			if tt.route == "" {
+				if route != nil {
+					t.Fatalf("expected no route, got %s", route.Path)
+				}
+				return
+			}
+			if route == nil || route.Path != tt.route {
+				t.Fatalf("expected %s, got %v", tt.route, route)
+			}
+			if len(params) != len(tt.params) {
+				t.Fatalf("expected params %v, got %v", tt.params, params)
+			}
+			for k, v := range tt.params {
+				if params[k] != v {
+					t.Errorf("expected %s=%s, got %s", k, v, params[k])
+				}
+			}
+		})
+	}
+}
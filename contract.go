@@ -0,0 +1,138 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Contract - @tag based filter deciding which parts of the schema are
+// published. Exclusions win over inclusions, and with no include tags
+// everything that is not excluded is published.
+type Contract struct {
+	Include map[string]bool
+	Exclude map[string]bool
+}
+
+// ParseContract - parse a comma separated list of tag names, names prefixed
+// with ! are excluded, e.g. "public,partner,!internal".
+func ParseContract(spec string) (*Contract, error) {
+	contract := &Contract{
+		Include: make(map[string]bool),
+		Exclude: make(map[string]bool),
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "!") {
+			name := strings.TrimSpace(item[1:])
+			if name == "" {
+				return nil, fmt.Errorf("empty exclude tag in contract %q", spec)
+			}
+			contract.Exclude[name] = true
+		} else {
+			contract.Include[item] = true
+		}
+	}
+	for name := range contract.Include {
+		if contract.Exclude[name] {
+			return nil, fmt.Errorf("tag %s is both included and excluded", name)
+		}
+	}
+	return contract, nil
+}
+
+func (c *Contract) String() string {
+	items := make([]string, 0, len(c.Include)+len(c.Exclude))
+	for name := range c.Include {
+		items = append(items, name)
+	}
+	for name := range c.Exclude {
+		items = append(items, "!"+name)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// Tags - names of all @tag directives in the list.
+func Tags(directives ast.DirectiveList) []string {
+	tags := make([]string, 0, 2)
+	for _, directive := range directives.ForNames("tag") {
+		if name := directive.Arguments.ForName("name"); name != nil && name.Value != nil {
+			tags = append(tags, name.Value.Raw)
+		}
+	}
+	return tags
+}
+
+func (c *Contract) excluded(directives ast.DirectiveList) bool {
+	for _, tag := range Tags(directives) {
+		if c.Exclude[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Contract) included(directives ast.DirectiveList) bool {
+	for _, tag := range Tags(directives) {
+		if c.Include[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// TypeAllowed - the named type is part of the contract.
+func (c *Contract) TypeAllowed(typeName string, schema *ast.Schema) bool {
+	if c == nil {
+		return true
+	}
+	def := schema.Types[typeName]
+	if def == nil || def.BuiltIn {
+		return true
+	}
+	return !c.excluded(def.Directives)
+}
+
+// FieldAllowed - the field is part of the contract. A field is included when
+// it, or the type declaring it, carries an included tag. Input object fields,
+// like arguments, are only ever removed by exclusion.
+func (c *Contract) FieldAllowed(parentType string, field *ast.FieldDefinition, schema *ast.Schema) bool {
+	if c == nil {
+		return true
+	}
+	if c.excluded(field.Directives) || !c.TypeAllowed(parentType, schema) || !c.TypeAllowed(field.Type.Name(), schema) {
+		return false
+	}
+	parent := schema.Types[parentType]
+	if parent != nil && parent.Kind == ast.InputObject {
+		return true
+	}
+	// a field can't be called without its required arguments
+	for _, arg := range field.Arguments {
+		if arg.Type.NonNull && arg.DefaultValue == nil && !c.ArgumentAllowed(arg, schema) {
+			return false
+		}
+	}
+	if len(c.Include) == 0 {
+		return true
+	}
+	if c.included(field.Directives) {
+		return true
+	}
+	return parent != nil && c.included(parent.Directives)
+}
+
+// ArgumentAllowed - the argument is part of the contract. Arguments are only
+// ever removed by exclusion.
+func (c *Contract) ArgumentAllowed(arg *ast.ArgumentDefinition, schema *ast.Schema) bool {
+	if c == nil {
+		return true
+	}
+	return !c.excluded(arg.Directives) && c.TypeAllowed(arg.Type.Name(), schema)
+}
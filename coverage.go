@@ -0,0 +1,347 @@
+package gemini
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+	"golang.org/x/exp/maps"
+)
+
+// reasons a schema field has no REST route
+const (
+	COVERAGE_CONTRACT      = "excluded by contract"
+	COVERAGE_DEPTH         = "depth limit"
+	COVERAGE_LOOP          = "loop detection"
+	COVERAGE_INPUT         = "unsupported input"
+	COVERAGE_NOT_SELECTED  = "object field without arguments, not selected"
+	COVERAGE_DEPRECATED    = "deprecated, not selected by default"
+	COVERAGE_UNREACHED     = "no route reaches its type"
+	COVERAGE_MUTATION      = "mutation, no route serves it"
+	COVERAGE_NO_SELECTIONS = "no fields a route can select"
+	COVERAGE_LEAF_TYPE     = "enum or custom scalar, not selected"
+)
+
+// CoverageGap - a field or argument reachable from Query/Mutation that no
+// route exposes.
+type CoverageGap struct {
+	Coordinate string // e.g. Book.authors or Query.findAuthors(input.sorting:)
+	Reason     string
+}
+
+// Coverage - fields reachable in the schema against fields exposed by routes.
+type Coverage struct {
+	Reachable int
+	Covered   int
+	Gaps      []CoverageGap
+}
+
+// routeCoverage - field coordinates and argument coordinates exposed by the
+// route map.
+type routeCoverage struct {
+	schema *ast.Schema
+	fields map[string]bool
+	args   map[string]bool
+}
+
+func (rc *routeCoverage) field(typeName, fieldName string) {
+	rc.fields[typeName+"."+fieldName] = true
+}
+
+func (rc *routeCoverage) arg(typeName, fieldName, argName string) {
+	rc.args[fmt.Sprintf("%s.%s(%s:)", typeName, fieldName, argName)] = true
+}
+
+// selections - mark the fields of a rendered selection set on typeName.
+func (rc *routeCoverage) selections(typeName string, sels []string) {
+	if len(sels) == 0 {
+		return
+	}
+	doc, err := parser.ParseQuery(&ast.Source{Input: "{" + strings.Join(sels, "\n") + "}"})
+	if err != nil || len(doc.Operations) != 1 {
+		return
+	}
+	rc.selectionSet(typeName, doc.Operations[0].SelectionSet)
+}
+
+func (rc *routeCoverage) selectionSet(typeName string, set ast.SelectionSet) {
+	def := rc.schema.Types[typeName]
+	if def == nil {
+		return
+	}
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			field := def.Fields.ForName(sel.Name)
+			if field == nil {
+				continue
+			}
+			rc.field(typeName, sel.Name)
+			if def.Kind == ast.Interface {
+				// selected on every implementation
+				for _, possible := range rc.schema.GetPossibleTypes(def) {
+					rc.field(possible.Name, sel.Name)
+				}
+			}
+			rc.selectionSet(field.Type.Name(), sel.SelectionSet)
+		case *ast.InlineFragment:
+			rc.selectionSet(sel.TypeCondition, sel.SelectionSet)
+		}
+	}
+}
+
+// route - mark everything a single route exposes.
+func (rc *routeCoverage) route(method *GetMethod) {
+	if method.Entity != nil {
+		if method.Entity.RootField != "" {
+			rc.field(rc.schema.Query.Name, method.Entity.RootField)
+			for _, keyField := range method.Entity.KeyFields {
+				rc.arg(rc.schema.Query.Name, method.Entity.RootField, keyField.Path[0])
+			}
+		}
+		rc.selections(method.Entity.TypeName, method.ResultSelections)
+		return
+	}
+
+	parentType := rc.schema.Query.Name
+	if method.Method == "POST" && rc.schema.Mutation != nil {
+		parentType = rc.schema.Mutation.Name
+	}
+	for _, item := range method.FieldPath {
+		ancestorType := strings.SplitN(item.FieldKey, ".", 2)[0]
+		rc.field(ancestorType, item.Path)
+		if item.IDInPath {
+			rc.arg(ancestorType, item.Path, item.Key.Arg)
+		}
+		for _, arg := range item.Args {
+			rc.arg(ancestorType, item.Path, arg.Arg)
+		}
+		parentType = item.Type
+	}
+
+	rc.field(parentType, method.OriginalField)
+	if method.IDInPath {
+		rc.arg(parentType, method.OriginalField, method.Key.Arg)
+	}
+	for param := range method.QueryString {
+		// flattened inputs are passed as input.field
+		rc.arg(parentType, method.OriginalField, strings.SplitN(param, ".", 2)[0])
+	}
+
+	def := rc.schema.Types[parentType]
+	if def == nil || def.Fields.ForName(method.OriginalField) == nil {
+		return
+	}
+	returnType := def.Fields.ForName(method.OriginalField).Type.Name()
+	rc.selections(returnType, method.ResultSelections)
+	for typeName, sels := range method.TypeSelections {
+		rc.selections(typeName, sels)
+	}
+	for _, include := range method.Includes {
+		rc.field(returnType, include.Field)
+		for _, arg := range include.Args {
+			rc.arg(returnType, include.Field, arg.Arg)
+		}
+		if field := rc.schema.Types[returnType].Fields.ForName(include.Field); field != nil {
+			rc.selections(field.Type.Name(), include.Selections)
+		}
+	}
+}
+
+// reachableTypes - object, interface and union types reachable from the
+// root types, with the fields leading into each of them.
+func reachableTypes(schema *ast.Schema, roots ...*ast.Definition) map[string][]string {
+	incoming := make(map[string][]string)
+	queue := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if root != nil {
+			incoming[root.Name] = nil
+			queue = append(queue, root.Name)
+		}
+	}
+	for len(queue) > 0 {
+		def := schema.Types[queue[0]]
+		queue = queue[1:]
+
+		next := make([]string, 0)
+		for _, field := range def.Fields {
+			if strings.HasPrefix(field.Name, "__") || IsHiddenField(field, schema) || IsScalar(field.Type.Name()) {
+				continue
+			}
+			inner := schema.Types[field.Type.Name()]
+			if inner == nil || inner.Kind == ast.Enum || IsHiddenType(inner.Name, schema) {
+				continue
+			}
+			targets := []string{inner.Name}
+			if inner.Kind == ast.Interface || inner.Kind == ast.Union {
+				for _, possible := range schema.GetPossibleTypes(inner) {
+					targets = append(targets, possible.Name)
+				}
+			}
+			for _, target := range targets {
+				_, seen := incoming[target]
+				incoming[target] = append(incoming[target], def.Name+"."+field.Name)
+				if !seen {
+					next = append(next, target)
+				}
+			}
+		}
+		queue = append(queue, next...)
+	}
+	return incoming
+}
+
+// CheckCoverage - compare every field reachable from Query and Mutation with
+// the route map and explain the ones left without a route.
+func CheckCoverage(schema *ast.Schema, routeMap map[string]*GetMethod, opts *RouteOptions) *Coverage {
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+	rc := &routeCoverage{
+		schema: schema,
+		fields: make(map[string]bool),
+		args:   make(map[string]bool),
+	}
+	for _, method := range routeMap {
+		rc.route(method)
+	}
+	skipped := map[string]string{}
+	if opts.Traversal != nil && opts.Traversal.Skipped != nil {
+		skipped = opts.Traversal.Skipped
+	}
+
+	coverage := &Coverage{}
+	gap := func(coordinate, reason string) {
+		coverage.Gaps = append(coverage.Gaps, CoverageGap{Coordinate: coordinate, Reason: reason})
+	}
+
+	incoming := reachableTypes(schema, schema.Query, schema.Mutation)
+	typeNames := maps.Keys(incoming)
+	sort.Strings(typeNames)
+	for _, typeName := range typeNames {
+		def := schema.Types[typeName]
+		if def.Kind == ast.Union {
+			continue
+		}
+		for _, field := range def.Fields {
+			if strings.HasPrefix(field.Name, "__") || IsHiddenField(field, schema) {
+				continue
+			}
+			coordinate := typeName + "." + field.Name
+			coverage.Reachable++
+			if rc.fields[coordinate] {
+				coverage.Covered++
+				checkArgumentCoverage(rc, def, field, opts, gap)
+				continue
+			}
+			gap(coordinate, uncoveredReason(def, field, skipped, incoming, rc, opts))
+		}
+	}
+
+	sort.Slice(coverage.Gaps, func(i, j int) bool {
+		return coverage.Gaps[i].Coordinate < coverage.Gaps[j].Coordinate
+	})
+	return coverage
+}
+
+// uncoveredReason - why a field has no route: its own skip reason, the one
+// of a field leading into its type, or how the mapping rules treat it.
+func uncoveredReason(def *ast.Definition, field *ast.FieldDefinition, skipped map[string]string, incoming map[string][]string, rc *routeCoverage, opts *RouteOptions) string {
+	if !opts.Contract.FieldAllowed(def.Name, field, rc.schema) {
+		return COVERAGE_CONTRACT
+	}
+	if IsDeprecatedField(field) && IsScalar(field.Type.Name()) {
+		return COVERAGE_DEPRECATED
+	}
+	if rc.schema.Mutation != nil && def.Name == rc.schema.Mutation.Name {
+		return COVERAGE_MUTATION
+	}
+	if leaf := rc.schema.Types[field.Type.Name()]; len(field.Arguments) == 0 && !IsScalar(field.Type.Name()) &&
+		leaf != nil && (leaf.Kind == ast.Enum || leaf.Kind == ast.Scalar) {
+		// only built-in scalars are selected
+		return COVERAGE_LEAF_TYPE
+	}
+	reason, ok := skipped[def.Name+"."+field.Name]
+	if len(field.Arguments) == 0 && !IsScalar(field.Type.Name()) && reason != COVERAGE_DEPTH {
+		// loops only repeat routes found elsewhere, the field is still never selected
+		return COVERAGE_NOT_SELECTED
+	}
+	if ok {
+		return reason
+	}
+	parents := append([]string{}, incoming[def.Name]...)
+	sort.Strings(parents)
+	for _, parent := range parents {
+		if reason, ok := skipped[parent]; ok && !rc.fields[parent] {
+			return fmt.Sprintf("%s at %s", reason, parent)
+		}
+	}
+	if rc.schema.Mutation != nil {
+		for _, parent := range parents {
+			if strings.HasPrefix(parent, rc.schema.Mutation.Name+".") && !rc.fields[parent] {
+				return fmt.Sprintf("%s at %s", COVERAGE_MUTATION, parent)
+			}
+		}
+	}
+	for _, parent := range parents {
+		parts := strings.SplitN(parent, ".", 2)
+		parentField := rc.schema.Types[parts[0]].Fields.ForName(parts[1])
+		if !rc.fields[parent] && len(parentField.Arguments) == 0 {
+			return fmt.Sprintf("%s at %s", COVERAGE_NOT_SELECTED, parent)
+		}
+	}
+	return COVERAGE_UNREACHED
+}
+
+// checkArgumentCoverage - report arguments of a covered field that can't be
+// passed, e.g. nested input objects.
+func checkArgumentCoverage(rc *routeCoverage, def *ast.Definition, field *ast.FieldDefinition, opts *RouteOptions, gap func(string, string)) {
+	for _, arg := range field.Arguments {
+		if IsHiddenArgument(arg, rc.schema) {
+			continue
+		}
+		coordinate := fmt.Sprintf("%s.%s(%s:)", def.Name, field.Name, arg.Name)
+		if !rc.args[coordinate] {
+			switch {
+			case !opts.Contract.ArgumentAllowed(arg, rc.schema):
+				gap(coordinate, COVERAGE_CONTRACT)
+			case !IsScalar(arg.Type.Name()):
+				gap(coordinate, COVERAGE_INPUT)
+			default:
+				gap(coordinate, COVERAGE_UNREACHED)
+			}
+			continue
+		}
+		input := rc.schema.Types[arg.Type.Name()]
+		if input == nil || input.Kind != ast.InputObject {
+			continue
+		}
+		for _, inner := range input.Fields {
+			if IsHiddenField(inner, rc.schema) {
+				continue
+			}
+			innerCoordinate := fmt.Sprintf("%s.%s(%s.%s:)", def.Name, field.Name, arg.Name, inner.Name)
+			if !opts.Contract.FieldAllowed(input.Name, inner, rc.schema) {
+				gap(innerCoordinate, COVERAGE_CONTRACT)
+			} else if !IsScalar(inner.Type.Name()) {
+				gap(innerCoordinate, COVERAGE_INPUT)
+			}
+		}
+	}
+}
+
+// WriteCoverage - print the gaps and a summary.
+func WriteCoverage(w io.Writer, coverage *Coverage) {
+	for _, gap := range coverage.Gaps {
+		fmt.Fprintf(w, "%s\t%s\n", gap.Coordinate, gap.Reason)
+	}
+	percent := 100.0
+	if coverage.Reachable > 0 {
+		percent = float64(coverage.Covered) * 100 / float64(coverage.Reachable)
+	}
+	fmt.Fprintf(w, "\n%d of %d reachable fields have a route (%.1f%%), %d gaps\n",
+		coverage.Covered, coverage.Reachable, percent, len(coverage.Gaps))
+}
@@ -0,0 +1,130 @@
+package gemini
+
+import (
+	"testing"
+)
+
+const coverageTestSchema = `
+type Query {
+  library(id: ID!): Library
+  search(filter: SearchFilter): [Title]
+  secret: String @tag(name: "internal")
+}
+type Mutation {
+  addBook(title: String!): AddBookPayload
+}
+type AddBookPayload {
+  book: Book
+  message: String
+}
+type Title {
+  text: String
+}
+type Library {
+  id: ID!
+  name: String
+  motto: String @deprecated(reason: "Use name.")
+  status: LibraryStatus
+  opened: Date
+  manager: Librarian
+  books(order: BookOrder!): [Book]
+}
+type Librarian {
+  name: String
+}
+type Book {
+  title: String
+  shelf: Shelf
+}
+type Shelf {
+  label: String
+  color: ShelfColor
+}
+scalar Date
+enum LibraryStatus {
+  OPEN
+  CLOSED
+}
+enum ShelfColor {
+  RED
+  BLUE
+}
+input SearchFilter {
+  title: String
+  range: YearRange
+  hidden: String @inaccessible
+}
+input BookOrder {
+  field: String
+}
+input YearRange {
+  from: Int
+  to: Int
+}
+`
+
+func TestCheckCoverage(t *testing.T) {
+	schema := loadTestSchema(t, coverageTestSchema)
+	contract, err := ParseContract("!internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &RouteOptions{Contract: contract, Traversal: &Traversal{MaxDepth: 1}}
+	routeMap, err := CreateRouteMap(schema, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverage := CheckCoverage(schema, routeMap, opts)
+
+	gaps := make(map[string]string, len(coverage.Gaps))
+	for _, gap := range coverage.Gaps {
+		gaps[gap.Coordinate] = gap.Reason
+	}
+
+	tests := []struct {
+		coordinate string
+		reason     string // empty when covered
+	}{
+		{"Query.library", ""},
+		{"Library.name", ""},
+		{"Library.books", ""},
+		{"Query.secret", COVERAGE_CONTRACT},
+		{"Library.motto", ""}, // selectable with ?_include=
+		{"Library.status", COVERAGE_LEAF_TYPE},
+		{"Library.opened", COVERAGE_LEAF_TYPE},
+		{"Shelf.color", COVERAGE_LEAF_TYPE},
+		{"Library.manager", COVERAGE_NOT_SELECTED},
+		{"Librarian.name", COVERAGE_NOT_SELECTED + " at Library.manager"},
+		{"Query.search(filter.range:)", COVERAGE_INPUT},
+		{"Query.search(filter.hidden:)", ""},
+		{"Book.shelf", COVERAGE_DEPTH},
+		{"AddBookPayload.book", COVERAGE_NOT_SELECTED},
+		{"Shelf.label", COVERAGE_DEPTH + " at Book.shelf"},
+		{"Mutation.addBook", COVERAGE_MUTATION},
+		{"AddBookPayload.message", COVERAGE_MUTATION + " at Mutation.addBook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.coordinate, func(t *testing.T) {
+			if reason := gaps[tt.coordinate]; reason != tt.reason {
+				t.Errorf("expected %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+
+	if coverage.Covered+len(coverageFieldGaps(coverage)) != coverage.Reachable {
+		t.Errorf("%d covered and %d field gaps don't add up to %d reachable fields",
+			coverage.Covered, len(coverageFieldGaps(coverage)), coverage.Reachable)
+	}
+}
+
+// coverageFieldGaps - gaps of fields, leaving out arguments.
+func coverageFieldGaps(coverage *Coverage) []CoverageGap {
+	fields := make([]CoverageGap, 0, len(coverage.Gaps))
+	for _, gap := range coverage.Gaps {
+		if gap.Coordinate[len(gap.Coordinate)-1] != ')' {
+			fields = append(fields, gap)
+		}
+	}
+	return fields
+}
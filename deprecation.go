@@ -0,0 +1,261 @@
+package gemini
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	DEFAULT_DEPRECATION_REASON = "No longer supported"
+	SUNSET_DATE_FORMAT         = "2006-01-02"
+)
+
+// Deprecation - a route or included field clients should move away from.
+type Deprecation struct {
+	Reason    string
+	Sunset    time.Time // zero without a configured sunset date
+	Link      string    // documentation, empty without DeprecationOptions.Docs
+	Successor string    // path replacing an aliased route
+}
+
+// DeprecationOptions - sunset dates and documentation for deprecated fields
+// and route aliases.
+type DeprecationOptions struct {
+	Sunsets map[string]time.Time // "Type.field", alias path or "*" for all -> sunset date
+	Docs    string               // base URL, the coordinate is added as fragment
+}
+
+// DeprecationReason - reason of a @deprecated directive, false when the
+// directives don't deprecate.
+func DeprecationReason(directives ast.DirectiveList) (string, bool) {
+	directive := directives.ForName("deprecated")
+	if directive == nil {
+		return "", false
+	}
+	if arg := directive.Arguments.ForName("reason"); arg != nil && arg.Value != nil && arg.Value.Kind != ast.NullValue {
+		return arg.Value.Raw, true
+	}
+	return DEFAULT_DEPRECATION_REASON, true
+}
+
+// IsDeprecatedField - field is marked @deprecated.
+func IsDeprecatedField(field *ast.FieldDefinition) bool {
+	_, ok := DeprecationReason(field.Directives)
+	return ok
+}
+
+// deprecation - details for a deprecated coordinate, with its sunset date
+// and documentation link when configured.
+func (o *DeprecationOptions) deprecation(coordinate, reason string) *Deprecation {
+	dep := &Deprecation{Reason: reason}
+	if o == nil {
+		return dep
+	}
+	if sunset, ok := o.Sunsets[coordinate]; ok {
+		dep.Sunset = sunset
+	} else if sunset, ok := o.Sunsets["*"]; ok {
+		dep.Sunset = sunset
+	}
+	if o.Docs != "" {
+		dep.Link = o.Docs + "#" + coordinate
+	}
+	return dep
+}
+
+// fieldDeprecation - deprecation of a single field, nil if it isn't.
+func fieldDeprecation(parentType string, field *ast.FieldDefinition, opts *RouteOptions) *Deprecation {
+	reason, ok := DeprecationReason(field.Directives)
+	if !ok {
+		return nil
+	}
+	return opts.Deprecations.deprecation(parentType+"."+field.Name, reason)
+}
+
+// routeDeprecation - a route is deprecated when its own field is, or else
+// when the closest of its ancestors is, e.g. everything below a deprecated
+// root field.
+func routeDeprecation(parentType string, queryField *ast.FieldDefinition, parentFieldPath []FieldPathDetail, schema *ast.Schema, opts *RouteOptions) *Deprecation {
+	if dep := fieldDeprecation(parentType, queryField, opts); dep != nil {
+		return dep
+	}
+	for i := len(parentFieldPath) - 1; i >= 0; i-- {
+		ancestorType := "Query"
+		if i > 0 {
+			ancestorType = parentFieldPath[i-1].Type
+		}
+		def := schema.Types[ancestorType]
+		if def == nil {
+			continue
+		}
+		if field := def.Fields.ForName(parentFieldPath[i].Path); field != nil {
+			if dep := fieldDeprecation(ancestorType, field, opts); dep != nil {
+				return dep
+			}
+		}
+	}
+	return nil
+}
+
+// routeTrie - the router's view of a route map, to check new paths against.
+func routeTrie(routeMap map[string]*GetMethod) *routeNode {
+	root := newRouteNode()
+	for path, method := range routeMap {
+		root.add(strings.Split(strings.TrimPrefix(path, "/"), "/"), method)
+	}
+	return root
+}
+
+// samePathParams - both routes take the same path params, in any order.
+func samePathParams(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// addRouteAlias - serve the route at to under from as well, marked deprecated
+// with to as its successor. Both paths must take the same path params, and
+// from must fit next to the existing routes.
+func addRouteAlias(routeMap map[string]*GetMethod, root *routeNode, from, to string, dep *Deprecation) error {
+	method := routeMap[to]
+	if method == nil {
+		return fmt.Errorf("no route %s to alias %s to", to, from)
+	}
+	if _, ok := routeMap[from]; ok {
+		return fmt.Errorf("%s is already a route", from)
+	}
+	fromParams := make([]string, 0)
+	segments := strings.Split(strings.TrimPrefix(from, "/"), "/")
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			fromParams = append(fromParams, segment[1:])
+		}
+	}
+	if !samePathParams(fromParams, method.PathParams) {
+		return fmt.Errorf("%s and %s take different path params", from, to)
+	}
+	if blocker, _ := root.find(segments); blocker != nil {
+		return fmt.Errorf("%s collides with %s", from, blocker.Path)
+	}
+
+	alias := *method
+	alias.Path = from
+	dep.Successor = to
+	alias.Deprecation = dep
+	root.add(segments, &alias)
+	routeMap[from] = &alias
+	return nil
+}
+
+// fillPath - a router path with its params replaced by the values of a
+// request, e.g. /:gemini_tenant/books/:book_isbn -> /acme/books/1.
+func fillPath(path string, params map[string]string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if value, ok := params[strings.TrimPrefix(segment, ":")]; ok && strings.HasPrefix(segment, ":") {
+			segments[i] = value
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// applyRouteAliases - serve renamed routes at their old path, aliases that
+// can't be served are skipped with a warning.
+func applyRouteAliases(routeMap map[string]*GetMethod, opts *RouteOptions) {
+	if len(opts.Aliases) == 0 {
+		return
+	}
+	root := routeTrie(routeMap)
+	froms := maps.Keys(opts.Aliases)
+	sort.Strings(froms)
+	for _, from := range froms {
+		to := opts.Aliases[from]
+		dep := opts.Deprecations.deprecation(from, fmt.Sprintf("Renamed to %s", to))
+		if err := addRouteAlias(routeMap, root, from, to, dep); err != nil {
+			opts.logger().Warnf("Cannot alias %s: %s", from, err)
+			continue
+		}
+		opts.logger().Infof("GET %s - deprecated alias of %s", from, to)
+	}
+}
+
+// writeDeprecationHeaders - announce a deprecation, e.g.
+//
+//	Deprecation: true
+//	Sunset: Sun, 31 Jan 2027 00:00:00 GMT
+//	Link: <https://docs.example.com/deprecations#Award.title>; rel="deprecation"; title="Use awardTitle"
+//
+// Aliases add a successor-version link and a Warning pointing at the new path.
+func writeDeprecationHeaders(header http.Header, dep *Deprecation) {
+	header.Set("Deprecation", "true")
+	if !dep.Sunset.IsZero() {
+		// the earliest sunset wins when several fields are deprecated
+		existing, err := http.ParseTime(header.Get("Sunset"))
+		if err != nil || dep.Sunset.Before(existing) {
+			header.Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+	title := strings.ReplaceAll(dep.Reason, `"`, `'`)
+	if dep.Link != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; title="%s"`, dep.Link, title))
+	}
+	if dep.Successor != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, dep.Successor))
+		header.Add("Warning", fmt.Sprintf(`299 - "Deprecated route, use %s"`, dep.Successor))
+	}
+}
+
+// ParseSunsets - parse sunset dates for deprecated fields and aliases, e.g.
+// "Award.title=2027-01-31,*=2027-06-30".
+func ParseSunsets(spec string) (map[string]time.Time, error) {
+	sunsets := make(map[string]time.Time)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("sunset must be in the form Type.field=YYYY-MM-DD, got %s", item)
+		}
+		date, err := time.Parse(SUNSET_DATE_FORMAT, parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sunset date for %s: %s", parts[0], err)
+		}
+		sunsets[parts[0]] = date
+	}
+	return sunsets, nil
+}
+
+// ParseRouteAliases - parse old paths of renamed routes, e.g.
+// "/library/:library_id/old_goodies=/library/:library_id/vault/goodies".
+func ParseRouteAliases(spec string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") || !strings.HasPrefix(parts[1], "/") {
+			return nil, fmt.Errorf("route alias must be in the form /old/path=/new/path, got %s", item)
+		}
+		aliases[parts[0]] = parts[1]
+	}
+	return aliases, nil
+}
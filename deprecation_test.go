@@ -0,0 +1,191 @@
+package gemini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDeprecationHeaders(t *testing.T) {
+	early := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		deps    []*Deprecation
+		sunset  string
+		links   []string
+		warning string
+	}{
+		{
+			name: "reason only",
+			deps: []*Deprecation{{Reason: "Use name."}},
+		},
+		{
+			name:   "sunset and docs",
+			deps:   []*Deprecation{{Reason: `Use "name".`, Sunset: early, Link: "https://docs.example.com/deprecations#Library.motto"}},
+			sunset: "Sun, 31 Jan 2027 00:00:00 GMT",
+			links:  []string{`<https://docs.example.com/deprecations#Library.motto>; rel="deprecation"; title="Use 'name'."`},
+		},
+		{
+			name:   "earliest sunset wins",
+			deps:   []*Deprecation{{Reason: "a", Sunset: late}, {Reason: "b", Sunset: early}, {Reason: "c", Sunset: late}},
+			sunset: "Sun, 31 Jan 2027 00:00:00 GMT",
+		},
+		{
+			name:    "alias",
+			deps:    []*Deprecation{{Reason: "Renamed to /books/:book_isbn", Successor: "/books/1"}},
+			links:   []string{`</books/1>; rel="successor-version"`},
+			warning: `299 - "Deprecated route, use /books/1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			for _, dep := range tt.deps {
+				writeDeprecationHeaders(header, dep)
+			}
+			if header.Get("Deprecation") != "true" {
+				t.Errorf("expected Deprecation: true, got %q", header.Get("Deprecation"))
+			}
+			if header.Get("Sunset") != tt.sunset {
+				t.Errorf("expected Sunset %q, got %q", tt.sunset, header.Get("Sunset"))
+			}
+			if strings.Join(header.Values("Link"), "\n") != strings.Join(tt.links, "\n") {
+				t.Errorf("expected Link %v, got %v", tt.links, header.Values("Link"))
+			}
+			if header.Get("Warning") != tt.warning {
+				t.Errorf("expected Warning %q, got %q", tt.warning, header.Get("Warning"))
+			}
+		})
+	}
+}
+
+func TestParseSunsets(t *testing.T) {
+	tests := []struct {
+		spec    string
+		sunsets map[string]string
+		err     bool
+	}{
+		{"", map[string]string{}, false},
+		{"Award.title=2027-01-31, *=2027-06-30", map[string]string{"Award.title": "2027-01-31", "*": "2027-06-30"}, false},
+		{"/old/path=2027-01-31", map[string]string{"/old/path": "2027-01-31"}, false},
+		{"Award.title", nil, true},
+		{"=2027-01-31", nil, true},
+		{"Award.title=31.01.2027", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			sunsets, err := ParseSunsets(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if len(sunsets) != len(tt.sunsets) {
+				t.Fatalf("expected %v, got %v", tt.sunsets, sunsets)
+			}
+			for coordinate, date := range tt.sunsets {
+				if sunsets[coordinate].Format(SUNSET_DATE_FORMAT) != date {
+					t.Errorf("expected %s=%s, got %s", coordinate, date, sunsets[coordinate])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRouteAliases(t *testing.T) {
+	tests := []struct {
+		spec    string
+		aliases map[string]string
+		err     bool
+	}{
+		{"", map[string]string{}, false},
+		{"/book/:book_isbn=/books/:book_isbn, /old=/new", map[string]string{"/book/:book_isbn": "/books/:book_isbn", "/old": "/new"}, false},
+		{"/old", nil, true},
+		{"old=/new", nil, true},
+		{"/old=new", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			aliases, err := ParseRouteAliases(tt.spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if len(aliases) != len(tt.aliases) {
+				t.Fatalf("expected %v, got %v", tt.aliases, aliases)
+			}
+			for from, to := range tt.aliases {
+				if aliases[from] != to {
+					t.Errorf("expected %s=%s, got %s", from, to, aliases[from])
+				}
+			}
+		})
+	}
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+	schema := loadTestSchema(t, `
+type Query {
+  book(isbn: ID!): Book
+  books: [Book]
+  bestseller: Book @deprecated(reason: "Use books.")
+}
+type Book {
+  isbn: ID!
+  title: String
+  subtitle: String @deprecated(reason: "Use title.")
+}
+`)
+	sunset := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)
+	handler, err := NewHandler(Options{
+		Schema: schema,
+		Routes: &RouteOptions{
+			Aliases:      map[string]string{"/book/:book_isbn": "/books/:book_isbn"},
+			Deprecations: &DeprecationOptions{Sunsets: map[string]time.Time{"Book.subtitle": sunset}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		deprecated bool
+		sunset     string
+		warning    string
+		subtitle   bool // subtitle is in the GraphQL document
+	}{
+		{"not selected by default", "/books/1", false, "", "", false},
+		{"included", "/books/1?_include=subtitle", true, "Sun, 31 Jan 2027 00:00:00 GMT", "", true},
+		{"deprecated root field", "/bestseller", true, "", "", false},
+		{"alias", "/book/1", true, "", `299 - "Deprecated route, use /books/1"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", tt.target, nil))
+			if recorder.Code != 200 {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+			}
+			header := recorder.Header()
+			if (header.Get("Deprecation") == "true") != tt.deprecated {
+				t.Errorf("expected deprecated %t, got %q", tt.deprecated, header.Get("Deprecation"))
+			}
+			if header.Get("Sunset") != tt.sunset {
+				t.Errorf("expected Sunset %q, got %q", tt.sunset, header.Get("Sunset"))
+			}
+			if header.Get("Warning") != tt.warning {
+				t.Errorf("expected Warning %q, got %q", tt.warning, header.Get("Warning"))
+			}
+			if strings.Contains(recorder.Body.String(), "subtitle") != tt.subtitle {
+				t.Errorf("expected subtitle selected %t, got %s", tt.subtitle, recorder.Body.String())
+			}
+		})
+	}
+}
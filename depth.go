@@ -0,0 +1,122 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Traversal - how deep route creation descends below each root field, and
+// the paths it had to cut off.
+type Traversal struct {
+	MaxDepth  int            // nested fields below a root field, MAX_PATH_DEPTH when 0
+	RootDepth map[string]int // per root field overrides
+	Cutoffs   []DepthCutoff
+	Skipped   map[string]string // field coordinate, e.g. Book.authors -> COVERAGE_* reason
+}
+
+// DepthCutoff - a route path not created because of the depth limit.
+type DepthCutoff struct {
+	Root  string
+	Path  string
+	Field string // coordinate of the field not followed, e.g. Blame.ranges
+	Limit int
+}
+
+// ParseDepthOverrides - parse per root field depths, e.g. "repository=5,viewer=2".
+func ParseDepthOverrides(spec string) (map[string]int, error) {
+	overrides := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("depth override must be in the form field=depth, got %s", item)
+		}
+		depth, err := strconv.Atoi(parts[1])
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid depth for %s: %s", parts[0], parts[1])
+		}
+		overrides[parts[0]] = depth
+	}
+	return overrides, nil
+}
+
+// Limit - maximum path depth below a root field.
+func (t *Traversal) Limit(root string) int {
+	if t == nil {
+		return MAX_PATH_DEPTH
+	}
+	if depth, ok := t.RootDepth[root]; ok {
+		return depth
+	}
+	if t.MaxDepth > 0 {
+		return t.MaxDepth
+	}
+	return MAX_PATH_DEPTH
+}
+
+// cutoff - record a path that was not descended into.
+func (t *Traversal) cutoff(root, path, coordinate string) {
+	if t == nil {
+		return
+	}
+	t.Cutoffs = append(t.Cutoffs, DepthCutoff{Root: root, Path: path, Field: coordinate, Limit: t.Limit(root)})
+	t.skip(coordinate, COVERAGE_DEPTH)
+}
+
+// skip - record why a field was not followed, the first reason is kept.
+func (t *Traversal) skip(coordinate, reason string) {
+	if t == nil {
+		return
+	}
+	if t.Skipped == nil {
+		t.Skipped = make(map[string]string)
+	}
+	if _, ok := t.Skipped[coordinate]; !ok {
+		t.Skipped[coordinate] = reason
+	}
+}
+
+// Report - log the cut off paths grouped by root field, so limits can be
+// raised where deeper routes are wanted.
+func (t *Traversal) Report(logger logrus.FieldLogger) {
+	if t == nil || len(t.Cutoffs) == 0 {
+		return
+	}
+	byRoot := make(map[string][]DepthCutoff)
+	roots := make([]string, 0)
+	for _, cutoff := range t.Cutoffs {
+		if _, ok := byRoot[cutoff.Root]; !ok {
+			roots = append(roots, cutoff.Root)
+		}
+		byRoot[cutoff.Root] = append(byRoot[cutoff.Root], cutoff)
+	}
+	sort.Strings(roots)
+
+	logger.Warnf("Depth limit cut off %d paths, raise with -max-depth or -root-depth:", len(t.Cutoffs))
+	for _, root := range roots {
+		cutoffs := byRoot[root]
+		logger.Warnf("  %s (depth %d): %d paths", root, cutoffs[0].Limit, len(cutoffs))
+		for _, cutoff := range cutoffs {
+			logger.Debugf("    %s", cutoff.Path)
+		}
+	}
+}
+
+// FieldKey - identifies a field in the traversal by its parent type, name and
+// arguments, e.g. Author.books(first,after). The same key twice in a path is a
+// cycle, whatever the fields are called along the way.
+func FieldKey(parentType string, field *ast.FieldDefinition) string {
+	args := make([]string, 0, len(field.Arguments))
+	for _, arg := range field.Arguments {
+		args = append(args, arg.Name)
+	}
+	return fmt.Sprintf("%s.%s(%s)", parentType, field.Name, strings.Join(args, ","))
+}
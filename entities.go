@@ -0,0 +1,332 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+	"golang.org/x/exp/maps"
+)
+
+// KeyField - one leaf of an entity @key, exposed as a path parameter.
+type KeyField struct {
+	Param string   // path parameter and variable name
+	Path  []string // field path inside the representation, e.g. brand.name
+	Type  string   // GraphQL scalar type of the leaf
+}
+
+// EntityLookup - how an entity route resolves its entity, either through a
+// root field taking exactly the key fields or through _entities on the
+// subgraph declaring the key.
+type EntityLookup struct {
+	TypeName    string
+	Key         string
+	KeyFields   []KeyField
+	RootField   string // matching Query field, empty to use _entities
+	Subgraph    string // subgraph to send _entities to
+	SubgraphURL string
+}
+
+// entityKey - one resolvable @join__type(key:) declaration.
+type entityKey struct {
+	Key         string
+	Subgraph    string
+	SubgraphURL string
+}
+
+// subgraphURL - resolve a join__Graph enum value to the url given in its
+// @join__graph(url:) directive.
+func subgraphURL(graph string, schema *ast.Schema) string {
+	graphEnum := schema.Types["join__Graph"]
+	if graphEnum == nil {
+		return ""
+	}
+	value := graphEnum.EnumValues.ForName(graph)
+	if value == nil {
+		return ""
+	}
+	joinGraph := value.Directives.ForName("join__graph")
+	if joinGraph == nil {
+		return ""
+	}
+	if url := joinGraph.Arguments.ForName("url"); url != nil && url.Value != nil {
+		return url.Value.Raw
+	}
+	return ""
+}
+
+// entityKeys - resolvable keys of a type in declaration order, each key once.
+func entityKeys(def *ast.Definition, schema *ast.Schema) []entityKey {
+	keys := make([]entityKey, 0, 2)
+	seen := make(map[string]bool)
+	for _, directive := range def.Directives.ForNames("join__type") {
+		key := directive.Arguments.ForName("key")
+		graph := directive.Arguments.ForName("graph")
+		if key == nil || key.Value == nil || graph == nil || graph.Value == nil {
+			continue
+		}
+		if resolvable := directive.Arguments.ForName("resolvable"); resolvable != nil &&
+			resolvable.Value != nil && resolvable.Value.Raw == "false" {
+			continue
+		}
+		normalized := strings.Join(strings.Fields(key.Value.Raw), " ")
+		if seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		keys = append(keys, entityKey{
+			Key:         normalized,
+			Subgraph:    subgraphName(graph.Value.Raw, schema),
+			SubgraphURL: subgraphURL(graph.Value.Raw, schema),
+		})
+	}
+	return keys
+}
+
+// parseKeyFields - flatten a key field set into its leaf fields.
+func parseKeyFields(typeName, key string, schema *ast.Schema) ([]KeyField, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Name: typeName + " @key", Input: "{" + key + "}"})
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse key %q on %s: %s", key, typeName, err)
+	}
+	if len(doc.Operations) != 1 {
+		return nil, fmt.Errorf("cannot parse key %q on %s", key, typeName)
+	}
+	keyFields, err := flattenKeySelections(typeName, nil, doc.Operations[0].SelectionSet, schema)
+	if err != nil {
+		return nil, err
+	}
+	// name params after the entity, like the params of root field routes
+	for i := range keyFields {
+		keyFields[i].Param = PathParamName(typeName, keyFields[i].Param)
+	}
+	return keyFields, nil
+}
+
+func flattenKeySelections(typeName string, parent []string, selections ast.SelectionSet, schema *ast.Schema) ([]KeyField, error) {
+	def := schema.Types[typeName]
+	if def == nil {
+		return nil, fmt.Errorf("unknown type %s in key", typeName)
+	}
+	fields := make([]KeyField, 0, len(selections))
+	for _, selection := range selections {
+		selected, ok := selection.(*ast.Field)
+		if !ok {
+			return nil, fmt.Errorf("fragments in keys are not supported on %s", typeName)
+		}
+		fieldDef := def.Fields.ForName(selected.Name)
+		if fieldDef == nil {
+			return nil, fmt.Errorf("unknown key field %s.%s", typeName, selected.Name)
+		}
+		path := append(append([]string{}, parent...), selected.Name)
+		if len(selected.SelectionSet) > 0 {
+			inner, err := flattenKeySelections(fieldDef.Type.Name(), path, selected.SelectionSet, schema)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, inner...)
+			continue
+		}
+		if fieldDef.Type.Elem != nil {
+			return nil, fmt.Errorf("list key field %s.%s can't be a path parameter", typeName, selected.Name)
+		}
+		params := make([]string, 0, len(path))
+		for _, part := range path {
+			params = append(params, ToSnakeCase(part))
+		}
+		fields = append(fields, KeyField{
+			Param: strings.Join(params, "_"),
+			Path:  path,
+			Type:  fieldDef.Type.Name(),
+		})
+	}
+	return fields, nil
+}
+
+// matchingRootField - a Query field returning the entity type whose required
+// arguments are exactly the (flat) key fields.
+func matchingRootField(typeName string, keyFields []KeyField, schema *ast.Schema, opts *RouteOptions) string {
+	if schema.Query == nil {
+		return ""
+	}
+	for _, keyField := range keyFields {
+		if len(keyField.Path) != 1 {
+			return ""
+		}
+	}
+	for _, field := range schema.Query.Fields {
+		if field.Type.Elem != nil || field.Type.Name() != typeName || len(field.Arguments) != len(keyFields) {
+			continue
+		}
+		if IsHiddenField(field, schema) || !opts.Contract.FieldAllowed(schema.Query.Name, field, schema) {
+			continue
+		}
+		matched := true
+		for _, keyField := range keyFields {
+			arg := field.Arguments.ForName(keyField.Path[0])
+			if arg == nil || arg.Type.Name() != keyField.Type {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return field.Name
+		}
+	}
+	return ""
+}
+
+// scalarSelections - default selection set for a type, every exposed scalar.
+func scalarSelections(def *ast.Definition, schema *ast.Schema, opts *RouteOptions) []string {
+	selections := make([]string, 0, len(def.Fields))
+	for _, field := range def.Fields {
+		if strings.HasPrefix(field.Name, "__") || len(field.Arguments) > 0 || !IsScalar(field.Type.Name()) {
+			continue
+		}
+		if IsHiddenField(field, schema) || IsDeprecatedField(field) || !opts.Contract.FieldAllowed(def.Name, field, schema) {
+			continue
+		}
+		selections = append(selections, field.Name)
+	}
+	return selections
+}
+
+// subgraphSelections - the selections a single subgraph can resolve.
+func subgraphSelections(def *ast.Definition, selections []string, subgraph string, schema *ast.Schema) []string {
+	filtered := make([]string, 0, len(selections))
+	for _, sel := range selections {
+		for _, graph := range SubgraphsForField(def.Name, def.Fields.ForName(sel), schema) {
+			if graph == subgraph {
+				filtered = append(filtered, sel)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// CreateEntityMethods - one GET route per entity key, e.g. /products/:upc.
+// The first usable key of a type gets the plain resource path, further keys are
+// qualified with the key fields, e.g. /products/by_sku_brand_name/:sku/:brand_name.
+func CreateEntityMethods(schema *ast.Schema, opts *RouteOptions) []*GetMethod {
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+	sigs := make([]*GetMethod, 0, 10)
+	if !IsSupergraph(schema) {
+		return sigs
+	}
+
+	typeNames := maps.Keys(schema.Types)
+	sort.Strings(typeNames)
+
+	for _, typeName := range typeNames {
+		def := schema.Types[typeName]
+		if def.Kind != ast.Object || IsHiddenType(def.Name, schema) || !opts.Contract.TypeAllowed(def.Name, schema) {
+			continue
+		}
+		if schema.Query != nil && def.Name == schema.Query.Name {
+			continue
+		}
+		if opts.Contract != nil && len(opts.Contract.Include) > 0 && len(scalarSelections(def, schema, opts)) == 0 {
+			// nothing of this type is published by the contract
+			continue
+		}
+
+		resource := "/" + opts.Inflector.Plural(ToSnakeCase(def.Name))
+		routed := 0
+		for _, key := range entityKeys(def, schema) {
+			keyFields, err := parseKeyFields(def.Name, key.Key, schema)
+			if err != nil {
+				opts.logger().Warnf("Skipping entity route: %s", err)
+				opts.Diagnostics.Add(LINT_ENTITY_KEY, fmt.Sprintf("%s @key(%s)", def.Name, key.Key), err.Error(), def.Position)
+				continue
+			}
+
+			params := make([]string, 0, len(keyFields))
+			segments := make([]string, 0, len(keyFields))
+			for _, keyField := range keyFields {
+				params = append(params, keyField.Param)
+				segments = append(segments, ":"+keyField.Param)
+			}
+
+			path := resource
+			if routed > 0 {
+				path = fmt.Sprintf("%s/by_%s", resource, strings.Join(params, "_"))
+			}
+			path = fmt.Sprintf("%s/%s", path, strings.Join(segments, "/"))
+
+			lookup := &EntityLookup{
+				TypeName:    def.Name,
+				Key:         key.Key,
+				KeyFields:   keyFields,
+				RootField:   matchingRootField(def.Name, keyFields, schema, opts),
+				Subgraph:    key.Subgraph,
+				SubgraphURL: key.SubgraphURL,
+			}
+
+			sig := &GetMethod{
+				Path:             path,
+				Method:           "GET",
+				QueryString:      make(map[string]TypeSignature),
+				ResultSelections: scalarSelections(def, schema, opts),
+				OriginalField:    lookup.RootField,
+				PathParams:       params,
+				Entity:           lookup,
+				Subgraphs:        []string{key.Subgraph},
+			}
+			if lookup.RootField == "" {
+				// _entities goes straight to the subgraph, which can only
+				// resolve its own fields
+				sig.OriginalField = "_entities"
+				sig.ResultSelections = subgraphSelections(def, sig.ResultSelections, key.Subgraph, schema)
+			}
+			sigs = append(sigs, sig)
+			routed++
+		}
+	}
+	return sigs
+}
+
+// coerceKeyValue - convert a path or query string parameter to its scalar
+// type, values that don't parse are passed on as strings.
+func coerceKeyValue(value, typeName string) interface{} {
+	switch typeName {
+	case "Int":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "Float":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "Boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// EntityRepresentation - build the _entities representation for a lookup
+// from the path parameter values.
+func EntityRepresentation(lookup *EntityLookup, variables map[string]interface{}) map[string]interface{} {
+	representation := map[string]interface{}{"__typename": lookup.TypeName}
+	for _, keyField := range lookup.KeyFields {
+		current := representation
+		for _, part := range keyField.Path[:len(keyField.Path)-1] {
+			next, ok := current[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				current[part] = next
+			}
+			current = next
+		}
+		value := fmt.Sprintf("%v", variables[keyField.Param])
+		current[keyField.Path[len(keyField.Path)-1]] = coerceKeyValue(value, keyField.Type)
+	}
+	return representation
+}
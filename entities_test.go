@@ -0,0 +1,131 @@
+package gemini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const entityTestSchema = `
+directive @join__graph(name: String!, url: String!) on ENUM_VALUE
+directive @join__type(graph: join__Graph!, key: join__FieldSet, extension: Boolean! = false, resolvable: Boolean! = true) repeatable on OBJECT | INTERFACE | UNION | ENUM | INPUT_OBJECT | SCALAR
+directive @join__field(graph: join__Graph, requires: join__FieldSet, provides: join__FieldSet, external: Boolean) repeatable on FIELD_DEFINITION | INPUT_FIELD_DEFINITION
+scalar join__FieldSet
+enum join__Graph {
+  INVENTORY @join__graph(name: "inventory", url: "http://inventory/graphql")
+  PRODUCTS @join__graph(name: "products", url: "http://products/graphql")
+}
+type Query @join__type(graph: PRODUCTS) {
+  product(upc: String!): Product @join__field(graph: PRODUCTS)
+}
+type Product
+  @join__type(graph: PRODUCTS, key: "upc")
+  @join__type(graph: PRODUCTS, key: "sku brand { name }")
+  @join__type(graph: INVENTORY, key: "upc") {
+  upc: String!
+  sku: String!
+  brand: Brand @join__field(graph: PRODUCTS)
+  price: Int @join__field(graph: PRODUCTS)
+  inStock: Boolean @join__field(graph: INVENTORY)
+}
+type Brand @join__type(graph: PRODUCTS) {
+  name: String!
+}
+type Warehouse
+  @join__type(graph: INVENTORY, key: "tags")
+  @join__type(graph: INVENTORY, key: "id") {
+  id: ID!
+  tags: [String!]!
+  name: String
+}
+type Review @join__type(graph: INVENTORY, key: "id", resolvable: false) {
+  id: ID!
+}
+`
+
+func TestCreateEntityMethods(t *testing.T) {
+	schema := loadTestSchema(t, entityTestSchema)
+	diagnostics := &Diagnostics{}
+	sigs := CreateEntityMethods(schema, &RouteOptions{Diagnostics: diagnostics})
+	routes := make(map[string]*GetMethod, len(sigs))
+	for _, sig := range sigs {
+		routes[sig.Path] = sig
+	}
+
+	tests := []struct {
+		path       string
+		keyFields  [][]string // field path of each key field
+		rootField  string
+		subgraph   string
+		selections []string
+	}{
+		{"/products/:product_upc", [][]string{{"upc"}}, "product", "products", []string{"upc", "sku", "price", "inStock"}},
+		{
+			"/products/by_product_sku_product_brand_name/:product_sku/:product_brand_name",
+			[][]string{{"sku"}, {"brand", "name"}}, "", "products", []string{"upc", "sku", "price"},
+		},
+		{"/warehouses/:warehouse_id", [][]string{{"id"}}, "", "inventory", []string{"id", "tags", "name"}},
+	}
+
+	if len(routes) != len(tests) {
+		t.Errorf("expected %d entity routes, got %v", len(tests), sigs)
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			sig := routes[tt.path]
+			if sig == nil {
+				t.Fatalf("missing route %s", tt.path)
+			}
+			paths := make([][]string, 0, len(sig.Entity.KeyFields))
+			for _, keyField := range sig.Entity.KeyFields {
+				paths = append(paths, keyField.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.keyFields) {
+				t.Errorf("expected key fields %v, got %v", tt.keyFields, paths)
+			}
+			if sig.Entity.RootField != tt.rootField {
+				t.Errorf("expected root field %q, got %q", tt.rootField, sig.Entity.RootField)
+			}
+			if sig.Entity.Subgraph != tt.subgraph {
+				t.Errorf("expected subgraph %s, got %s", tt.subgraph, sig.Entity.Subgraph)
+			}
+			if !reflect.DeepEqual(sig.ResultSelections, tt.selections) {
+				t.Errorf("expected selections %v, got %v", tt.selections, sig.ResultSelections)
+			}
+		})
+	}
+
+	found := false
+	for _, item := range diagnostics.Items {
+		if item.Rule == LINT_ENTITY_KEY && strings.HasPrefix(item.Coordinate, "Warehouse") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected %s for the list key of Warehouse, got %v", LINT_ENTITY_KEY, diagnostics.Items)
+	}
+}
+
+func TestEntityRepresentation(t *testing.T) {
+	lookup := &EntityLookup{
+		TypeName: "Product",
+		KeyFields: []KeyField{
+			{Param: "product_sku", Path: []string{"sku"}, Type: "Int"},
+			{Param: "product_brand_name", Path: []string{"brand", "name"}, Type: "String"},
+			{Param: "product_brand_country", Path: []string{"brand", "country"}, Type: "String"},
+		},
+	}
+	representation := EntityRepresentation(lookup, map[string]interface{}{
+		"product_sku":           "42",
+		"product_brand_name":    "acme",
+		"product_brand_country": "NZ",
+	})
+	expected := map[string]interface{}{
+		"__typename": "Product",
+		"sku":        int64(42),
+		"brand":      map[string]interface{}{"name": "acme", "country": "NZ"},
+	}
+	if !reflect.DeepEqual(representation, expected) {
+		t.Errorf("expected %v, got %v", expected, representation)
+	}
+}
@@ -0,0 +1,132 @@
+package gemini
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Prefixes of the types a supergraph uses for its own bookkeeping, these are
+// never part of the API.
+var federationTypePrefixes = []string{"join__", "link__", "core__", "federation__"}
+
+// Types subgraph schemas add for the router, also not part of the API.
+var federationTypes = map[string]bool{
+	"_Any":     true,
+	"_Entity":  true,
+	"_Service": true,
+	"FieldSet": true,
+}
+
+// IsFederationType - the type is federation plumbing rather than API.
+func IsFederationType(typeName string) bool {
+	if federationTypes[typeName] {
+		return true
+	}
+	for _, prefix := range federationTypePrefixes {
+		if strings.HasPrefix(typeName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInaccessible - the definition carries @inaccessible (possibly renamed
+// through @link) and must not be exposed.
+func IsInaccessible(directives ast.DirectiveList) bool {
+	return directives.ForName("inaccessible") != nil ||
+		directives.ForName("federation__inaccessible") != nil
+}
+
+// IsHiddenType - type must not be reachable over REST.
+func IsHiddenType(typeName string, schema *ast.Schema) bool {
+	if IsFederationType(typeName) {
+		return true
+	}
+	def := schema.Types[typeName]
+	return def != nil && IsInaccessible(def.Directives)
+}
+
+// IsHiddenField - field must not be exposed over REST, either because it is
+// inaccessible itself or because its return type is.
+func IsHiddenField(field *ast.FieldDefinition, schema *ast.Schema) bool {
+	if field.Name == "_service" || field.Name == "_entities" {
+		return true
+	}
+	return IsInaccessible(field.Directives) || IsHiddenType(field.Type.Name(), schema)
+}
+
+// IsHiddenArgument - argument must not be accepted over REST.
+func IsHiddenArgument(arg *ast.ArgumentDefinition, schema *ast.Schema) bool {
+	return IsInaccessible(arg.Directives) || IsHiddenType(arg.Type.Name(), schema)
+}
+
+// IsSupergraph - schema was composed by federation and carries join metadata.
+func IsSupergraph(schema *ast.Schema) bool {
+	_, ok := schema.Types["join__Graph"]
+	return ok
+}
+
+// subgraphName - resolve a join__Graph enum value to the subgraph name given
+// in its @join__graph(name:) directive.
+func subgraphName(graph string, schema *ast.Schema) string {
+	graphEnum := schema.Types["join__Graph"]
+	if graphEnum == nil {
+		return graph
+	}
+	value := graphEnum.EnumValues.ForName(graph)
+	if value == nil {
+		return graph
+	}
+	joinGraph := value.Directives.ForName("join__graph")
+	if joinGraph == nil {
+		return graph
+	}
+	if name := joinGraph.Arguments.ForName("name"); name != nil && name.Value != nil {
+		return name.Value.Raw
+	}
+	return graph
+}
+
+// joinGraphs - subgraph names from the graph argument of every directive
+// with the given name.
+func joinGraphs(directives ast.DirectiveList, directiveName string, schema *ast.Schema) []string {
+	graphs := make([]string, 0, 2)
+	for _, directive := range directives.ForNames(directiveName) {
+		graph := directive.Arguments.ForName("graph")
+		if graph == nil || graph.Value == nil {
+			continue
+		}
+		graphs = append(graphs, subgraphName(graph.Value.Raw, schema))
+	}
+	return graphs
+}
+
+// SubgraphsForField - names of the subgraphs that resolve a field, taken from
+// @join__field on the field or, failing that, @join__type on its parent.
+func SubgraphsForField(parentType string, field *ast.FieldDefinition, schema *ast.Schema) []string {
+	if !IsSupergraph(schema) {
+		return nil
+	}
+
+	graphs := joinGraphs(field.Directives, "join__field", schema)
+	if len(graphs) == 0 {
+		if parent := schema.Types[parentType]; parent != nil {
+			graphs = joinGraphs(parent.Directives, "join__type", schema)
+		}
+	}
+
+	// de-duplicate, the same subgraph may declare a type several times with
+	// different keys
+	seen := make(map[string]bool, len(graphs))
+	unique := make([]string, 0, len(graphs))
+	for _, graph := range graphs {
+		if !seen[graph] {
+			seen[graph] = true
+			unique = append(unique, graph)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
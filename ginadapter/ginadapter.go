@@ -0,0 +1,26 @@
+// Package ginadapter - serve a gemini.Handler's routes from a gin router, so
+// gin matches the paths and the handler answers them like ServeHTTP.
+package ginadapter
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jesse-apollo/gemini"
+)
+
+// Register - add every route of the handler to a gin router.
+func Register(router gin.IRoutes, handler *gemini.Handler) {
+	for path := range handler.Routes {
+		router.GET(path, Handler(handler))
+	}
+}
+
+// Handler - the handler as a gin handler for routes registered with their path.
+func Handler(handler *gemini.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			params[param.Key] = param.Value
+		}
+		handler.ServeRoute(c.Writer, c.Request, c.FullPath(), params)
+	}
+}
@@ -1,89 +1,333 @@
-package main
+package gemini
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 
-	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
-func getHandler(routeMap map[string]*GetMethod) gin.HandlerFunc {
+// Options - what NewHandler needs to serve a schema as REST routes.
+type Options struct {
+	Schema   *ast.Schema
+	Routes   *RouteOptions      // route generation, nil means defaults
+	Prefix   string             // serve every route below it, e.g. /api
+	Upstream *Upstream          // nil answers with the GraphQL request instead
+	Tenants  *Tenants           // picks the upstream per request instead of Upstream
+	Logger   logrus.FieldLogger // nil logs to the logrus standard logger
+}
 
-	return func(c *gin.Context) {
-		log.Infof("GET - Handler called, route: %s", c.FullPath())
+// Handler - serves the GET routes of a route map as an http.Handler, so it
+// can be mounted on net/http, chi or any other router. Gin routers can
+// register the routes themselves with the ginadapter package.
+type Handler struct {
+	Routes   map[string]*GetMethod // by router path, e.g. /library/:library_id
+	Upstream *Upstream
+	Tenants  *Tenants
+	Logger   logrus.FieldLogger // nil logs to the logrus standard logger
 
-		route := routeMap[c.FullPath()]
-		if route == nil {
-			log.Errorf("Route %s not found.", c.FullPath())
-			c.JSON(404, gin.H{
-				"message": "No such route.",
-			})
-			return
-		}
-		variables := make(map[string]interface{})
-		if route.IDInPath {
-			variables["id"] = c.Param("id")
-		}
-		for k, v := range c.Request.URL.Query() {
-			if len(v) > 1 {
-				variables[k] = v
-			} else {
-				variables[k] = v[0]
-			}
-		}
+	root       *routeNode
+	hooks      []Hook
+	routeHooks map[string][]Hook
+}
 
-		queryString, opName := BuildQuery(route, &variables)
+// NewHandler - build the routes of a schema and serve them.
+func NewHandler(opts Options) (*Handler, error) {
+	if opts.Schema == nil {
+		return nil, fmt.Errorf("no schema to build routes from")
+	}
+	routeOpts := opts.Routes
+	if opts.Logger != nil && (routeOpts == nil || routeOpts.Logger == nil) {
+		local := RouteOptions{}
+		if routeOpts != nil {
+			local = *routeOpts
+		}
+		local.Logger = opts.Logger
+		routeOpts = &local
+	}
+	routeMap, err := CreateRouteMap(opts.Schema, routeOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Prefix != "" {
+		routeMap = MountRoutes(routeMap, strings.TrimSuffix(opts.Prefix, "/"))
+	}
+	handler := NewRouteHandler(routeMap, opts.Upstream, opts.Tenants)
+	handler.Logger = opts.Logger
+	return handler, nil
+}
 
-		_ = opName
+// logger - where the handler logs, Logger or the logrus standard logger.
+func (h *Handler) logger() logrus.FieldLogger {
+	return orStandardLogger(h.Logger)
+}
 
-		log.Infof("Route found, building GQL.")
-		log.Infof(queryString)
+// NewRouteHandler - serve an already built route map, e.g. one checked
+// against a lockfile.
+func NewRouteHandler(routeMap map[string]*GetMethod, upstream *Upstream, tenants *Tenants) *Handler {
+	routeMap = tenants.Routes(routeMap)
+	return &Handler{
+		Routes:   routeMap,
+		Upstream: upstream,
+		Tenants:  tenants,
+		root:     routeTrie(routeMap),
+	}
+}
 
-		postBody := make(map[string]interface{})
-		postBody["variables"] = variables
-		postBody["operationName"] = opName
-		postBody["query"] = queryString
+// ServeHTTP - match the request path against the routes and answer it.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := make(map[string]string)
+	route := h.root.match(strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/"), params)
+	if route == nil {
+		h.logger().Errorf("Route %s not found.", r.URL.Path)
+		h.writeJSON(w, 404, map[string]interface{}{
+			"message": "No such route.",
+		})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.writeJSON(w, 405, map[string]interface{}{
+			"message": fmt.Sprintf("%s is not allowed on this route.", r.Method),
+		})
+		return
+	}
+	h.serveRoute(w, r, route, params)
+}
 
-		c.JSON(200, postBody)
+// ServeRoute - answer a request for the route at path, already matched by
+// another router, params holds the path params of the request.
+func (h *Handler) ServeRoute(w http.ResponseWriter, r *http.Request, path string, params map[string]string) {
+	route := h.Routes[path]
+	if route == nil {
+		h.logger().Errorf("Route %s not found.", path)
+		h.writeJSON(w, 404, map[string]interface{}{
+			"message": "No such route.",
+		})
+		return
 	}
+	h.serveRoute(w, r, route, params)
 }
 
-func postHandler(routeMap map[string]*GetMethod) gin.HandlerFunc {
+// writeJSON - write a JSON response.
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		h.logger().Errorf("Cannot encode response: %s", err)
+		status = 500
+		data = []byte(`{"message":"Cannot encode response."}`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
 
-	return func(c *gin.Context) {
-		log.Infof("POST - Handler called, route: %s", c.FullPath())
+// serveRoute - answer a GET request for a matched route, params holds the
+// path params of the request.
+func (h *Handler) serveRoute(w http.ResponseWriter, r *http.Request, route *GetMethod, params map[string]string) {
+	h.logger().Infof("GET - Handler called, route: %s", route.Path)
 
-		route := routeMap[c.FullPath()]
-		if route == nil {
-			log.Errorf("Route %s not found.", c.FullPath())
-			c.JSON(404, gin.H{
-				"message": "No such route.",
+	upstream := h.Upstream
+	if h.Tenants != nil {
+		tenant, selected, err := h.Tenants.Select(r, params[TENANT_PARAM])
+		if err != nil {
+			status := 500
+			var tenantErr *TenantError
+			if errors.As(err, &tenantErr) {
+				status = tenantErr.Status
+			}
+			h.writeJSON(w, status, map[string]interface{}{
+				"message": err.Error(),
 			})
 			return
 		}
+		h.logger().Infof("Tenant %s", tenant)
+		upstream = selected
+	}
+	if route.Deprecation != nil {
+		deprecation := *route.Deprecation
+		if deprecation.Successor != "" {
+			// the successor of /book/1 is /books/1, not /books/:book_isbn
+			deprecation.Successor = fillPath(deprecation.Successor, params)
+		}
+		writeDeprecationHeaders(w.Header(), &deprecation)
+	}
 
-		postData := make(map[string]interface{})
+	ctx := &RequestContext{
+		Request:        r,
+		ResponseHeader: w.Header(),
+		Route:          route,
+		Params:         params,
+		Query:          r.URL.Query(),
+		Upstream:       upstream,
+	}
+	if !h.runHooks(w, ctx, beforeVariables(ctx)) {
+		return
+	}
 
-		err := json.NewDecoder(c.Request.Body).Decode(&postData)
-		if err != nil {
-			log.Errorf("Cannot decode request body: %s", err)
-			return
+	variables := make(map[string]interface{})
+	for _, param := range route.PathParams {
+		variables[param] = coerceKeyValue(ctx.Params[param], route.PathParamTypes[param].Type)
+	}
+	query := ctx.Query
+	for _, item := range route.FieldPath {
+		// ancestor arguments, e.g. ?library.filter=x
+		readPrefixedArgs(query, item.Args, variables)
+	}
+
+	// fields with arguments added to the selection, e.g.
+	// ?_include=issues&_args.issues.first=10
+	includes := make([]string, 0)
+	if v, ok := query["_include"]; ok {
+		for _, name := range strings.Split(strings.Join(v, ","), ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			include := route.Includes[name]
+			if include == nil {
+				h.writeJSON(w, 400, map[string]interface{}{
+					"message": fmt.Sprintf("Cannot include %s on this route.", name),
+				})
+				return
+			}
+			includes = append(includes, name)
+			if include.Deprecation != nil {
+				writeDeprecationHeaders(w.Header(), include.Deprecation)
+			}
+			readPrefixedArgs(query, include.Args, variables)
+			for _, arg := range include.Args {
+				if _, ok := variables[arg.Variable]; !ok && arg.Sig.Required && arg.Sig.Default == nil {
+					h.writeJSON(w, 400, map[string]interface{}{
+						"message": fmt.Sprintf("Missing %s, required to include %s.", arg.Param, name),
+					})
+					return
+				}
+			}
 		}
+		query.Del("_include")
+	}
 
-		if route.IDInPath {
-			postData["id"] = c.Param("id")
+	for k, v := range query {
+		if strings.HasPrefix(k, "_args.") {
+			// arguments of a field that wasn't included
+			continue
 		}
+		variables[k] = queryValue(v, route.QueryString[k])
+	}
 
-		queryString, opName := BuildQuery(route, &postData)
+	// list elements addressed in the path, picked from the response
+	selectors := make(map[string]string)
+	for _, item := range route.FieldPath {
+		if item.ListParam != "" {
+			selectors[item.ListParam] = ctx.Params[item.ListParam]
+		}
+	}
 
-		log.Infof("Route found, building GQL.")
-		log.Infof(queryString)
+	ctx.Document, ctx.OperationName = BuildQuery(route, &variables, includes)
+	ctx.Variables = variables
+	ctx.Includes = includes
+	if !h.runHooks(w, ctx, afterDocument(ctx)) {
+		return
+	}
+
+	h.logger().Infof("Route found, building GQL.")
+	h.logger().Infof(ctx.Document)
 
+	if ctx.Upstream == nil {
+		// no upstream configured, show the GraphQL request instead
 		postBody := make(map[string]interface{})
-		postBody["variables"] = postData
-		postBody["operationName"] = opName
-		postBody["query"] = queryString
+		postBody["variables"] = ctx.Variables
+		postBody["operationName"] = ctx.OperationName
+		postBody["query"] = ctx.Document
+
+		h.writeJSON(w, 200, postBody)
+		return
+	}
 
-		c.JSON(200, postBody)
+	url := ""
+	if route.Entity != nil && route.Entity.RootField == "" {
+		url = route.Entity.SubgraphURL
+	}
+	var err error
+	ctx.UpstreamRequest, err = ctx.Upstream.NewRequest(url, ctx.Document, ctx.OperationName, ctx.Variables)
+	if err == nil {
+		ctx.UpstreamRequest = ctx.UpstreamRequest.WithContext(r.Context())
+		if !h.runHooks(w, ctx, beforeUpstream(ctx)) {
+			return
+		}
+		ctx.Response, err = ctx.Upstream.Do(ctx.UpstreamRequest)
+	}
+	var upstreamErr *UpstreamError
+	if err != nil && (!errors.As(err, &upstreamErr) || len(upstreamErr.Errors) == 0) {
+		h.logger().Errorf("Upstream request failed: %s", err)
+		h.writeJSON(w, 502, map[string]interface{}{
+			"message": "Upstream request failed.",
+		})
+		return
+	}
+
+	if upstreamErr != nil {
+		h.logger().Warnf("Upstream request failed: %s", err)
+		// request errors, e.g. invalid variables, are the client's to fix
+		ctx.Status = 502
+		if upstreamErr.StatusCode >= 400 && upstreamErr.StatusCode < 500 {
+			ctx.Status = upstreamErr.StatusCode
+		}
+		ctx.Response = &GQLResponse{Errors: upstreamErr.Errors}
+		ctx.Result = map[string]interface{}{
+			"message": "Upstream returned errors.",
+			"errors":  upstreamErr.Errors,
+		}
+	} else if len(ctx.Response.Errors) > 0 && ctx.Response.Data == nil {
+		ctx.Status = 502
+		ctx.Result = map[string]interface{}{
+			"message": "Upstream returned errors.",
+			"errors":  ctx.Response.Errors,
+		}
+	} else if result, err := ShapeResult(route, ctx.Response.Data, selectors); err != nil {
+		ctx.Status = 404
+		ctx.Result = map[string]interface{}{
+			"message": err.Error(),
+		}
+	} else {
+		ctx.Status = 200
+		ctx.Result = result
+	}
+	if !h.runHooks(w, ctx, afterResponse(ctx)) {
+		return
+	}
+	h.writeJSON(w, ctx.Status, ctx.Result)
+}
+
+// queryValue - variable value for a query string parameter, converted to
+// the argument's scalar type. Repeated parameters and comma separated lists
+// become lists.
+func queryValue(v []string, sig TypeSignature) interface{} {
+	if len(v) == 1 && sig.List {
+		v = strings.Split(v[0], ",")
+	}
+	if len(v) > 1 || sig.List {
+		values := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			values = append(values, coerceKeyValue(item, sig.Type))
+		}
+		return values
+	}
+	return coerceKeyValue(v[0], sig.Type)
+}
+
+// readPrefixedArgs - move prefixed arguments from the query string into
+// their variables.
+func readPrefixedArgs(query url.Values, args []PrefixedArg, variables map[string]interface{}) {
+	for _, arg := range args {
+		if v, ok := query[arg.Param]; ok {
+			variables[arg.Variable] = queryValue(v, arg.Sig)
+			query.Del(arg.Param)
+		}
 	}
 }
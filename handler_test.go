@@ -0,0 +1,327 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+const handlerTestSchema = `
+type Query {
+  book(isbn: ID!): Book
+  books: [Book]
+}
+type Book {
+  isbn: ID!
+  title: String
+}
+`
+
+// newTestHandler - handler for handlerTestSchema sending requests to an
+// upstream answering with status and body.
+func newTestHandler(t *testing.T, status int, body string) *Handler {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(upstream.Close)
+
+	handler, err := NewHandler(Options{
+		Schema:   loadTestSchema(t, handlerTestSchema),
+		Upstream: NewUpstream(upstream.URL, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// serveTest - answer a GET request, returning the status and decoded body.
+func serveTest(t *testing.T, handler http.Handler, target string) (int, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", target, nil))
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("cannot decode response %q: %s", recorder.Body.String(), err)
+	}
+	return recorder.Code, body
+}
+
+func TestHandlerUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     int
+		message  string
+		gqlError string
+	}{
+		{"data", 200, `{"data":{"book":{"isbn":"1","title":"Dune"}}}`, 200, "", ""},
+		{"errors without data", 200, `{"data":null,"errors":[{"message":"boom","path":["book"]}]}`, 502, "Upstream returned errors.", "boom"},
+		{"invalid variables", 400, `{"errors":[{"message":"Variable \"$isbn\" got invalid value"}]}`, 400, "Upstream returned errors.", "Variable \"$isbn\" got invalid value"},
+		{"server error with errors", 500, `{"errors":[{"message":"resolver crashed"}]}`, 502, "Upstream returned errors.", "resolver crashed"},
+		{"server error without errors", 503, `upstream down`, 502, "Upstream request failed.", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serveTest(t, newTestHandler(t, tt.status, tt.body), "/books/1")
+			if status != tt.want {
+				t.Fatalf("expected status %d, got %d: %v", tt.want, status, body)
+			}
+			if tt.message == "" {
+				if body["title"] != "Dune" {
+					t.Errorf("expected the book, got %v", body)
+				}
+				return
+			}
+			if body["message"] != tt.message {
+				t.Errorf("expected message %q, got %v", tt.message, body["message"])
+			}
+			gqlErrors, _ := body["errors"].([]interface{})
+			if tt.gqlError == "" {
+				if gqlErrors != nil {
+					t.Errorf("expected no errors, got %v", gqlErrors)
+				}
+				return
+			}
+			if len(gqlErrors) != 1 || gqlErrors[0].(map[string]interface{})["message"] != tt.gqlError {
+				t.Errorf("expected error %q, got %v", tt.gqlError, body["errors"])
+			}
+		})
+	}
+}
+
+func TestHandlerTenants(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"book":{"isbn":"1","title":"` + r.Header.Get("X-Library") + `"}}}`))
+	}))
+	t.Cleanup(upstream.Close)
+	config := func(from string) TenantConfig {
+		return TenantConfig{From: from, Tenants: map[string]TenantUpstream{
+			"acme": {Upstream: upstream.URL, Headers: map[string]string{"X-Library": "Acme"}},
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		from   string
+		target string
+		tenant string // X-Tenant header
+		want   int
+	}{
+		{"header", TENANT_FROM_HEADER, "/books/1", "acme", 200},
+		{"missing header", TENANT_FROM_HEADER, "/books/1", "", 400},
+		{"unknown header", TENANT_FROM_HEADER, "/books/1", "globex", 404},
+		{"path", TENANT_FROM_PATH, "/acme/books/1", "", 200},
+		{"unknown path", TENANT_FROM_PATH, "/globex/books/1", "", 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenants, err := NewTenants(config(tt.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler, err := NewHandler(Options{Schema: loadTestSchema(t, handlerTestSchema), Tenants: tenants})
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("GET", tt.target, nil)
+			if tt.tenant != "" {
+				request.Header.Set("X-Tenant", tt.tenant)
+			}
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, recorder.Code, recorder.Body.String())
+			}
+			body := make(map[string]interface{})
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == 200 && body["title"] != "Acme" {
+				t.Errorf("expected the tenant's upstream to answer, got %v", body)
+			}
+			if tt.want != 200 && body["message"] == nil {
+				t.Errorf("expected a message, got %v", body)
+			}
+		})
+	}
+}
+
+func TestHandlerLogger(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	handler, err := NewHandler(Options{
+		Schema: loadTestSchema(t, handlerTestSchema),
+		Logger: logger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.Entries) == 0 {
+		t.Errorf("expected route generation to log to Options.Logger")
+	}
+
+	hook.Reset()
+	recorder := httptest.NewRecorder()
+	handler.ServeRoute(recorder, httptest.NewRequest("GET", "/books/1", nil), "/books/:book_isbn", map[string]string{"book_isbn": "1"})
+	if recorder.Code != 200 || len(hook.Entries) == 0 {
+		t.Errorf("expected the request to be answered and logged, got %d with %d log entries", recorder.Code, len(hook.Entries))
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeRoute(recorder, httptest.NewRequest("GET", "/authors", nil), "/authors", nil)
+	if recorder.Code != 404 {
+		t.Errorf("expected 404 for an unknown route, got %d", recorder.Code)
+	}
+}
+
+type testAuthHook struct{ err error }
+
+func (h testAuthHook) BeforeVariables(ctx *RequestContext) error {
+	return h.err
+}
+
+type testWrapHook struct{}
+
+func (testWrapHook) AfterResponse(ctx *RequestContext) error {
+	ctx.Result = map[string]interface{}{"item": ctx.Result}
+	return nil
+}
+
+func TestHandlerHooks(t *testing.T) {
+	denied := &StatusError{Status: 401, Message: "Missing API key."}
+	tests := []struct {
+		name    string
+		hook    Hook
+		want    int
+		message string
+	}{
+		{"passes", testAuthHook{}, 200, ""},
+		{"status error", testAuthHook{err: denied}, 401, "Missing API key."},
+		{"wrapped status error", testAuthHook{err: fmt.Errorf("checking key: %w", denied)}, 401, "Missing API key."},
+		{"other error", testAuthHook{err: fmt.Errorf("key store down")}, 500, "Request hook failed."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(t, 200, `{"data":{"book":{"isbn":"1","title":"Dune"}}}`)
+			if err := handler.Use(tt.hook); err != nil {
+				t.Fatal(err)
+			}
+			if err := handler.UseRoute("/books/:book_isbn", testWrapHook{}); err != nil {
+				t.Fatal(err)
+			}
+			status, body := serveTest(t, handler, "/books/1")
+			if status != tt.want {
+				t.Fatalf("expected status %d, got %d: %v", tt.want, status, body)
+			}
+			if tt.message != "" {
+				if body["message"] != tt.message {
+					t.Errorf("expected message %q, got %v", tt.message, body["message"])
+				}
+				return
+			}
+			if item, _ := body["item"].(map[string]interface{}); item["title"] != "Dune" {
+				t.Errorf("expected the route hook to wrap the book, got %v", body)
+			}
+		})
+	}
+}
+
+func TestHandlerUseErrors(t *testing.T) {
+	handler := newTestHandler(t, 200, `{}`)
+	if err := handler.Use(testAuthHook{}, "not a hook"); err == nil {
+		t.Errorf("expected an error for a value implementing no hook interface")
+	}
+	if err := handler.UseRoute("/authors", testAuthHook{}); err == nil {
+		t.Errorf("expected an error for an unknown route")
+	}
+	if err := handler.UseRoute("/books", struct{}{}); err == nil {
+		t.Errorf("expected an error for a value implementing no hook interface")
+	}
+	if len(handler.hooks) != 0 || len(handler.routeHooks) != 0 {
+		t.Errorf("expected failed calls to add no hooks, got %v and %v", handler.hooks, handler.routeHooks)
+	}
+}
+
+func TestHandlerPathKeyTypes(t *testing.T) {
+	var variables map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Variables map[string]interface{} `json:"variables"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		variables = request.Variables
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"issue":{"number":5,"title":"Crash"}}}`))
+	}))
+	defer upstream.Close()
+
+	handler, err := NewHandler(Options{
+		Schema: loadTestSchema(t, `
+type Query {
+  issue(number: Int!): Issue
+}
+type Issue {
+  number: Int!
+  title: String
+}
+`),
+		Routes:   &RouteOptions{PathKeys: map[string]bool{"number": true}},
+		Upstream: NewUpstream(upstream.URL, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := serveTest(t, handler, "/issue/5")
+	if status != 200 {
+		t.Fatalf("expected status 200, got %d: %v", status, body)
+	}
+	// JSON numbers decode as float64, a string "5" would fail upstream
+	if number, ok := variables["issue_number"].(float64); !ok || number != 5 {
+		t.Errorf("expected issue_number to be sent as the number 5, got %#v", variables["issue_number"])
+	}
+}
+
+func TestHandlerIncludeArgs(t *testing.T) {
+	handler, err := NewHandler(Options{Schema: loadTestSchema(t, `
+type Query {
+  viewer: User
+}
+type User {
+  login: String
+  organization(login: String!): Organization
+}
+type Organization {
+  name: String
+}
+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := serveTest(t, handler, "/viewer?_include=organization")
+	if status != 400 || body["message"] != "Missing _args.organization.login, required to include organization." {
+		t.Errorf("expected 400 for the missing argument, got %d: %v", status, body)
+	}
+
+	// without an upstream the GraphQL request is answered
+	status, body = serveTest(t, handler, "/viewer?_include=organization&_args.organization.login=acme")
+	if status != 200 {
+		t.Fatalf("expected status 200, got %d: %v", status, body)
+	}
+	if variables, _ := body["variables"].(map[string]interface{}); variables["include__organization__login"] != "acme" {
+		t.Errorf("expected the include argument to be passed, got %v", body)
+	}
+}
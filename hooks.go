@@ -0,0 +1,166 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RequestContext - one REST request on its way to the upstream and back.
+// Hooks see it at every stage and may change what the following stages use.
+type RequestContext struct {
+	Request        *http.Request
+	ResponseHeader http.Header // headers of the REST response
+	Route          *GetMethod
+	Params         map[string]string // path params, e.g. library_id
+	Query          url.Values        // query string, read into Variables after BeforeVariables
+
+	Variables     map[string]interface{}
+	Includes      []string // fields added with ?_include=
+	Document      string   // GraphQL document, set after the variables
+	OperationName string
+
+	Upstream        *Upstream     // nil answers with the GraphQL request instead
+	UpstreamRequest *http.Request // set before BeforeUpstream
+
+	Response *GQLResponse // decoded upstream response
+	Status   int          // status of the REST response
+	Result   interface{}  // body of the REST response
+}
+
+// Hook - a value implementing one or more of the hook interfaces below.
+type Hook interface{}
+
+// BeforeVariablesHook - called before path params and the query string are
+// read into variables, e.g. to authenticate or rewrite params.
+type BeforeVariablesHook interface {
+	BeforeVariables(ctx *RequestContext) error
+}
+
+// AfterDocumentHook - called once the GraphQL document is built, e.g. to
+// inspect or replace the document and its variables.
+type AfterDocumentHook interface {
+	AfterDocument(ctx *RequestContext) error
+}
+
+// BeforeUpstreamHook - called with the upstream request before it is sent,
+// e.g. to add headers.
+type BeforeUpstreamHook interface {
+	BeforeUpstream(ctx *RequestContext) error
+}
+
+// AfterResponseHook - called once the upstream response is decoded and
+// shaped into Status and Result, e.g. to reshape the REST response.
+type AfterResponseHook interface {
+	AfterResponse(ctx *RequestContext) error
+}
+
+// StatusError - a hook error answered with its status, e.g. 401 from an
+// authentication hook. Other errors are answered with 500.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// isHook - the value implements at least one hook interface.
+func isHook(hook Hook) bool {
+	switch hook.(type) {
+	case BeforeVariablesHook, AfterDocumentHook, BeforeUpstreamHook, AfterResponseHook:
+		return true
+	}
+	return false
+}
+
+// Use - run hooks on every route, in the order they are added. Hooks must be
+// added before the handler serves requests. Nothing is added when a value
+// implements no hook interface.
+func (h *Handler) Use(hooks ...Hook) error {
+	for _, hook := range hooks {
+		if !isHook(hook) {
+			return fmt.Errorf("%T implements no hook interface", hook)
+		}
+	}
+	h.hooks = append(h.hooks, hooks...)
+	return nil
+}
+
+// UseRoute - run hooks on one route, by its router path, after the hooks
+// added with Use.
+func (h *Handler) UseRoute(path string, hooks ...Hook) error {
+	if h.Routes[path] == nil {
+		return fmt.Errorf("no route %s to add hooks to", path)
+	}
+	for _, hook := range hooks {
+		if !isHook(hook) {
+			return fmt.Errorf("%T implements no hook interface", hook)
+		}
+	}
+	if h.routeHooks == nil {
+		h.routeHooks = make(map[string][]Hook)
+	}
+	h.routeHooks[path] = append(h.routeHooks[path], hooks...)
+	return nil
+}
+
+// runHooks - call stage with every hook of the request's route, false when a
+// hook failed and its error was answered.
+func (h *Handler) runHooks(w http.ResponseWriter, ctx *RequestContext, stage func(Hook) error) bool {
+	hooks := append(append([]Hook{}, h.hooks...), h.routeHooks[ctx.Route.Path]...)
+	for _, hook := range hooks {
+		if err := stage(hook); err != nil {
+			status, message := 500, "Request hook failed."
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				status, message = statusErr.Status, statusErr.Message
+			} else {
+				h.logger().Errorf("Hook %T failed on %s: %s", hook, ctx.Route.Path, err)
+			}
+			h.writeJSON(w, status, map[string]interface{}{
+				"message": message,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+func beforeVariables(ctx *RequestContext) func(Hook) error {
+	return func(hook Hook) error {
+		if hook, ok := hook.(BeforeVariablesHook); ok {
+			return hook.BeforeVariables(ctx)
+		}
+		return nil
+	}
+}
+
+func afterDocument(ctx *RequestContext) func(Hook) error {
+	return func(hook Hook) error {
+		if hook, ok := hook.(AfterDocumentHook); ok {
+			return hook.AfterDocument(ctx)
+		}
+		return nil
+	}
+}
+
+func beforeUpstream(ctx *RequestContext) func(Hook) error {
+	return func(hook Hook) error {
+		if hook, ok := hook.(BeforeUpstreamHook); ok {
+			return hook.BeforeUpstream(ctx)
+		}
+		return nil
+	}
+}
+
+func afterResponse(ctx *RequestContext) func(Hook) error {
+	return func(hook Hook) error {
+		if hook, ok := hook.(AfterResponseHook); ok {
+			return hook.AfterResponse(ctx)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,431 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const IntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      ...FullType
+    }
+    directives {
+      name
+      description
+      locations
+      isRepeatable
+      args {
+        ...InputValue
+      }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args {
+      ...InputValue
+    }
+    type {
+      ...TypeRef
+    }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields {
+    ...InputValue
+  }
+  interfaces {
+    ...TypeRef
+  }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes {
+    ...TypeRef
+  }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType {
+                kind
+                name
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+type IntrospectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *IntrospectionTypeRef `json:"ofType"`
+}
+
+type IntrospectionInputValue struct {
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	Type         IntrospectionTypeRef `json:"type"`
+	DefaultValue *string              `json:"defaultValue"`
+}
+
+type IntrospectionField struct {
+	Name              string                    `json:"name"`
+	Description       string                    `json:"description"`
+	Args              []IntrospectionInputValue `json:"args"`
+	Type              IntrospectionTypeRef      `json:"type"`
+	IsDeprecated      bool                      `json:"isDeprecated"`
+	DeprecationReason *string                   `json:"deprecationReason"`
+}
+
+type IntrospectionEnumValue struct {
+	Name              string  `json:"name"`
+	Description       string  `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type IntrospectionType struct {
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Description   string                    `json:"description"`
+	Fields        []IntrospectionField      `json:"fields"`
+	InputFields   []IntrospectionInputValue `json:"inputFields"`
+	Interfaces    []IntrospectionTypeRef    `json:"interfaces"`
+	EnumValues    []IntrospectionEnumValue  `json:"enumValues"`
+	PossibleTypes []IntrospectionTypeRef    `json:"possibleTypes"`
+}
+
+type IntrospectionDirective struct {
+	Name         string                    `json:"name"`
+	Description  string                    `json:"description"`
+	Locations    []string                  `json:"locations"`
+	IsRepeatable bool                      `json:"isRepeatable"`
+	Args         []IntrospectionInputValue `json:"args"`
+}
+
+type IntrospectionNamedType struct {
+	Name string `json:"name"`
+}
+
+type IntrospectionSchema struct {
+	QueryType        *IntrospectionNamedType  `json:"queryType"`
+	MutationType     *IntrospectionNamedType  `json:"mutationType"`
+	SubscriptionType *IntrospectionNamedType  `json:"subscriptionType"`
+	Types            []IntrospectionType      `json:"types"`
+	Directives       []IntrospectionDirective `json:"directives"`
+}
+
+type IntrospectionData struct {
+	Schema *IntrospectionSchema `json:"__schema"`
+}
+
+type IntrospectionResult struct {
+	Data   IntrospectionData `json:"data"`
+	Errors []GQLError        `json:"errors"`
+}
+
+// HeaderFlags - repeatable "Name: value" command line flag.
+type HeaderFlags []string
+
+func (h *HeaderFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *HeaderFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be in the form 'Name: value', got %s", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// Header - convert the flag values to an http.Header.
+func (h HeaderFlags) Header() http.Header {
+	header := http.Header{}
+	for _, line := range h {
+		parts := strings.SplitN(line, ":", 2)
+		header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return header
+}
+
+// introspectSchema - run the standard introspection query against a GraphQL
+// endpoint and return the schema as SDL.
+func introspectSchema(url string, headers http.Header, logger logrus.FieldLogger) (string, error) {
+
+	var q = GQLQuery{
+		Variables:     map[string]interface{}{},
+		Query:         IntrospectionQuery,
+		OperationName: "IntrospectionQuery",
+	}
+
+	body, _ := json.Marshal(q)
+
+	httpClient := http.Client{}
+	postRequest, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", fmt.Errorf("could create request %s", err)
+	}
+
+	postRequest.Header.Set("Accept", "application/json")
+	postRequest.Header.Set("Content-Type", "application/json")
+	for name, values := range headers {
+		for _, value := range values {
+			postRequest.Header.Add(name, value)
+		}
+	}
+
+	resp, err := httpClient.Do(postRequest)
+	if err != nil {
+		return "", fmt.Errorf("could not introspect %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("introspection of %s responded with HTTP %d: %s", url, resp.StatusCode, respBody)
+	}
+
+	result := &IntrospectionResult{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return "", fmt.Errorf("could not decode introspection result: %s", err)
+	}
+
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, gqlErr := range result.Errors {
+			messages = append(messages, gqlErr.Message)
+		}
+		return "", fmt.Errorf("introspection of %s returned errors: %s", url, strings.Join(messages, "; "))
+	}
+	if result.Data.Schema == nil {
+		return "", fmt.Errorf("introspection of %s returned no schema", url)
+	}
+
+	logger.Infof("Introspected %d types from %s", len(result.Data.Schema.Types), url)
+
+	return IntrospectionToSDL(result.Data.Schema), nil
+}
+
+var builtInDirectives = map[string]bool{
+	"skip":        true,
+	"include":     true,
+	"deprecated":  true,
+	"specifiedBy": true,
+}
+
+// IntrospectionToSDL - render an introspection result as SDL so it can go
+// through gql.LoadSchema like any other schema source.
+func IntrospectionToSDL(schema *IntrospectionSchema) string {
+	builder := strings.Builder{}
+
+	// without root types the default names apply, an empty schema block
+	// doesn't parse
+	if schema.QueryType != nil || schema.MutationType != nil || schema.SubscriptionType != nil {
+		builder.WriteString("schema {\n")
+		if schema.QueryType != nil {
+			builder.WriteString(fmt.Sprintf("  query: %s\n", schema.QueryType.Name))
+		}
+		if schema.MutationType != nil {
+			builder.WriteString(fmt.Sprintf("  mutation: %s\n", schema.MutationType.Name))
+		}
+		if schema.SubscriptionType != nil {
+			builder.WriteString(fmt.Sprintf("  subscription: %s\n", schema.SubscriptionType.Name))
+		}
+		builder.WriteString("}\n")
+	}
+
+	for _, directive := range schema.Directives {
+		if builtInDirectives[directive.Name] {
+			continue
+		}
+		builder.WriteString("\n")
+		writeDescription(&builder, directive.Description, "")
+		builder.WriteString("directive @")
+		builder.WriteString(directive.Name)
+		writeArguments(&builder, directive.Args)
+		if directive.IsRepeatable {
+			builder.WriteString(" repeatable")
+		}
+		builder.WriteString(" on ")
+		builder.WriteString(strings.Join(directive.Locations, " | "))
+		builder.WriteString("\n")
+	}
+
+	for _, t := range schema.Types {
+		if strings.HasPrefix(t.Name, "__") || IsScalar(t.Name) {
+			continue
+		}
+		builder.WriteString("\n")
+		writeDescription(&builder, t.Description, "")
+
+		switch t.Kind {
+		case "SCALAR":
+			builder.WriteString(fmt.Sprintf("scalar %s\n", t.Name))
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if t.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+			builder.WriteString(fmt.Sprintf("%s %s", keyword, t.Name))
+			if len(t.Interfaces) > 0 {
+				names := make([]string, 0, len(t.Interfaces))
+				for _, iface := range t.Interfaces {
+					names = append(names, iface.Name)
+				}
+				builder.WriteString(" implements ")
+				builder.WriteString(strings.Join(names, " & "))
+			}
+			builder.WriteString(" {\n")
+			for _, field := range t.Fields {
+				writeDescription(&builder, field.Description, "  ")
+				builder.WriteString("  ")
+				builder.WriteString(field.Name)
+				writeArguments(&builder, field.Args)
+				builder.WriteString(": ")
+				builder.WriteString(typeRefString(&field.Type))
+				writeDeprecated(&builder, field.IsDeprecated, field.DeprecationReason)
+				builder.WriteString("\n")
+			}
+			builder.WriteString("}\n")
+		case "UNION":
+			names := make([]string, 0, len(t.PossibleTypes))
+			for _, possible := range t.PossibleTypes {
+				names = append(names, possible.Name)
+			}
+			builder.WriteString(fmt.Sprintf("union %s = %s\n", t.Name, strings.Join(names, " | ")))
+		case "ENUM":
+			builder.WriteString(fmt.Sprintf("enum %s {\n", t.Name))
+			for _, value := range t.EnumValues {
+				writeDescription(&builder, value.Description, "  ")
+				builder.WriteString("  ")
+				builder.WriteString(value.Name)
+				writeDeprecated(&builder, value.IsDeprecated, value.DeprecationReason)
+				builder.WriteString("\n")
+			}
+			builder.WriteString("}\n")
+		case "INPUT_OBJECT":
+			builder.WriteString(fmt.Sprintf("input %s {\n", t.Name))
+			for _, field := range t.InputFields {
+				writeDescription(&builder, field.Description, "  ")
+				builder.WriteString("  ")
+				writeInputValue(&builder, field)
+				builder.WriteString("\n")
+			}
+			builder.WriteString("}\n")
+		default:
+			builder.WriteString(fmt.Sprintf("# %s skipped, unknown type kind %s\n", t.Name, t.Kind))
+		}
+	}
+
+	return builder.String()
+}
+
+func typeRefString(ref *IntrospectionTypeRef) string {
+	switch ref.Kind {
+	case "NON_NULL":
+		return typeRefString(ref.OfType) + "!"
+	case "LIST":
+		return "[" + typeRefString(ref.OfType) + "]"
+	}
+	return ref.Name
+}
+
+func writeDescription(builder *strings.Builder, description, indent string) {
+	if description == "" {
+		return
+	}
+	builder.WriteString(indent)
+	builder.WriteString("\"\"\"\n")
+	builder.WriteString(strings.ReplaceAll(description, `"""`, `\"""`))
+	builder.WriteString("\n")
+	builder.WriteString(indent)
+	builder.WriteString("\"\"\"\n")
+}
+
+func writeDeprecated(builder *strings.Builder, deprecated bool, reason *string) {
+	if !deprecated {
+		return
+	}
+	builder.WriteString(" @deprecated")
+	if reason != nil {
+		quoted, _ := json.Marshal(*reason)
+		builder.WriteString(fmt.Sprintf("(reason: %s)", quoted))
+	}
+}
+
+func writeInputValue(builder *strings.Builder, value IntrospectionInputValue) {
+	builder.WriteString(value.Name)
+	builder.WriteString(": ")
+	builder.WriteString(typeRefString(&value.Type))
+	if value.DefaultValue != nil {
+		builder.WriteString(" = ")
+		builder.WriteString(*value.DefaultValue)
+	}
+}
+
+func writeArguments(builder *strings.Builder, args []IntrospectionInputValue) {
+	if len(args) == 0 {
+		return
+	}
+	inputs := make([]string, 0, len(args))
+	for _, arg := range args {
+		argBuilder := strings.Builder{}
+		writeInputValue(&argBuilder, arg)
+		inputs = append(inputs, argBuilder.String())
+	}
+	builder.WriteString("(")
+	builder.WriteString(strings.Join(inputs, ", "))
+	builder.WriteString(")")
+}
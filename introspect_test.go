@@ -0,0 +1,260 @@
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	gql "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"golang.org/x/exp/maps"
+)
+
+const introspectionTestSchema = `
+"""Where a field is documented."""
+directive @docs(section: String = "general", tags: [String!] = ["api", "v1"]) repeatable on FIELD_DEFINITION | OBJECT
+
+scalar DateTime
+
+interface Node {
+  id: ID!
+}
+
+"""A book, "quoted" in places."""
+type Book implements Node {
+  id: ID!
+  title: String @docs(section: "titles")
+  published: DateTime
+  format: Format
+  legacyTitle: String @deprecated(reason: "Use \"title\".")
+  related(first: Int = 10, order: BookOrder = {field: TITLE, desc: false}): [Book!]!
+}
+
+type Author implements Node {
+  id: ID!
+  name: String @deprecated
+}
+
+union SearchResult = Book | Author
+
+enum Format {
+  HARDCOVER
+  PAPERBACK
+  EBOOK @deprecated(reason: "Not sold anymore.")
+}
+
+enum SortField {
+  TITLE
+  YEAR
+}
+
+input BookOrder {
+  field: SortField! = TITLE
+  desc: Boolean = false
+}
+
+type Query {
+  node(id: ID!): Node
+  search(term: String!, limit: Int = 20): [SearchResult]
+}
+
+type Mutation {
+  addBook(title: String!): Book
+}
+`
+
+// introspectionOf - what an endpoint serving schema answers to
+// IntrospectionQuery.
+func introspectionOf(schema *ast.Schema) *IntrospectionSchema {
+	kinds := map[ast.DefinitionKind]string{
+		ast.Scalar: "SCALAR", ast.Object: "OBJECT", ast.Interface: "INTERFACE",
+		ast.Union: "UNION", ast.Enum: "ENUM", ast.InputObject: "INPUT_OBJECT",
+	}
+	var typeRef func(t *ast.Type) IntrospectionTypeRef
+	typeRef = func(t *ast.Type) IntrospectionTypeRef {
+		if t.NonNull {
+			nullable := *t
+			nullable.NonNull = false
+			inner := typeRef(&nullable)
+			return IntrospectionTypeRef{Kind: "NON_NULL", OfType: &inner}
+		}
+		if t.Elem != nil {
+			inner := typeRef(t.Elem)
+			return IntrospectionTypeRef{Kind: "LIST", OfType: &inner}
+		}
+		return IntrospectionTypeRef{Kind: kinds[schema.Types[t.NamedType].Kind], Name: t.NamedType}
+	}
+	inputValue := func(name, description string, t *ast.Type, defaultValue *ast.Value) IntrospectionInputValue {
+		value := IntrospectionInputValue{Name: name, Description: description, Type: typeRef(t)}
+		if defaultValue != nil {
+			raw := defaultValue.String()
+			value.DefaultValue = &raw
+		}
+		return value
+	}
+	deprecation := func(directives ast.DirectiveList) (bool, *string) {
+		reason, ok := DeprecationReason(directives)
+		if !ok {
+			return false, nil
+		}
+		return true, &reason
+	}
+
+	result := &IntrospectionSchema{}
+	if schema.Query != nil {
+		result.QueryType = &IntrospectionNamedType{Name: schema.Query.Name}
+	}
+	if schema.Mutation != nil {
+		result.MutationType = &IntrospectionNamedType{Name: schema.Mutation.Name}
+	}
+	names := maps.Keys(schema.Types)
+	sort.Strings(names)
+	for _, name := range names {
+		def := schema.Types[name]
+		t := IntrospectionType{Kind: kinds[def.Kind], Name: def.Name, Description: def.Description}
+		for _, field := range def.Fields {
+			if def.Kind == ast.InputObject {
+				t.InputFields = append(t.InputFields, inputValue(field.Name, field.Description, field.Type, field.DefaultValue))
+				continue
+			}
+			if strings.HasPrefix(field.Name, "__") {
+				// __schema and __type aren't listed on Query
+				continue
+			}
+			f := IntrospectionField{Name: field.Name, Description: field.Description, Type: typeRef(field.Type)}
+			for _, arg := range field.Arguments {
+				f.Args = append(f.Args, inputValue(arg.Name, arg.Description, arg.Type, arg.DefaultValue))
+			}
+			f.IsDeprecated, f.DeprecationReason = deprecation(field.Directives)
+			t.Fields = append(t.Fields, f)
+		}
+		for _, iface := range def.Interfaces {
+			t.Interfaces = append(t.Interfaces, IntrospectionTypeRef{Kind: "INTERFACE", Name: iface})
+		}
+		for _, possible := range def.Types {
+			t.PossibleTypes = append(t.PossibleTypes, IntrospectionTypeRef{Kind: "OBJECT", Name: possible})
+		}
+		for _, value := range def.EnumValues {
+			v := IntrospectionEnumValue{Name: value.Name, Description: value.Description}
+			v.IsDeprecated, v.DeprecationReason = deprecation(value.Directives)
+			t.EnumValues = append(t.EnumValues, v)
+		}
+		result.Types = append(result.Types, t)
+	}
+	directiveNames := maps.Keys(schema.Directives)
+	sort.Strings(directiveNames)
+	for _, name := range directiveNames {
+		def := schema.Directives[name]
+		d := IntrospectionDirective{Name: def.Name, Description: def.Description, IsRepeatable: def.IsRepeatable}
+		for _, location := range def.Locations {
+			d.Locations = append(d.Locations, string(location))
+		}
+		for _, arg := range def.Arguments {
+			d.Args = append(d.Args, inputValue(arg.Name, arg.Description, arg.Type, arg.DefaultValue))
+		}
+		result.Directives = append(result.Directives, d)
+	}
+	return result
+}
+
+// describeSchema - the parts of a schema introspection carries, one line per
+// type, field, argument, enum value and directive.
+func describeSchema(schema *ast.Schema) []string {
+	lines := make([]string, 0)
+	deprecated := func(directives ast.DirectiveList) string {
+		if reason, ok := DeprecationReason(directives); ok {
+			return " deprecated: " + reason
+		}
+		return ""
+	}
+	defaultOf := func(value *ast.Value) string {
+		if value == nil {
+			return ""
+		}
+		return " = " + value.String()
+	}
+	for name, def := range schema.Types {
+		if strings.HasPrefix(name, "__") || IsScalar(name) {
+			continue
+		}
+		lines = append(lines, string(def.Kind)+" "+name+" "+def.Description+
+			" implements "+strings.Join(def.Interfaces, "&")+" of "+strings.Join(def.Types, "|"))
+		for _, field := range def.Fields {
+			if strings.HasPrefix(field.Name, "__") {
+				continue
+			}
+			lines = append(lines, name+"."+field.Name+": "+field.Type.String()+defaultOf(field.DefaultValue)+deprecated(field.Directives))
+			for _, arg := range field.Arguments {
+				lines = append(lines, name+"."+field.Name+"("+arg.Name+": "+arg.Type.String()+defaultOf(arg.DefaultValue)+")")
+			}
+		}
+		for _, value := range def.EnumValues {
+			lines = append(lines, name+"."+value.Name+deprecated(value.Directives))
+		}
+	}
+	for name, def := range schema.Directives {
+		locations := make([]string, 0, len(def.Locations))
+		for _, location := range def.Locations {
+			locations = append(locations, string(location))
+		}
+		lines = append(lines, "@"+name+" on "+strings.Join(locations, "|")+" "+def.Description)
+		for _, arg := range def.Arguments {
+			lines = append(lines, "@"+name+"("+arg.Name+": "+arg.Type.String()+defaultOf(arg.DefaultValue)+")")
+		}
+	}
+	if schema.Mutation != nil {
+		lines = append(lines, "mutation "+schema.Mutation.Name)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestIntrospectionRoundTrip(t *testing.T) {
+	original := loadTestSchema(t, introspectionTestSchema)
+	body, err := json.Marshal(IntrospectionResult{Data: IntrospectionData{Schema: introspectionOf(original)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer endpoint.Close()
+
+	introspected, err := LoadSchema(&IntrospectionSource{URL: endpoint.URL, Headers: http.Header{"Authorization": {"Bearer token"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := describeSchema(original)
+	got := describeSchema(introspected)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("introspected schema differs\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if _, err := LoadSchema(&IntrospectionSource{URL: endpoint.URL}); err == nil {
+		t.Errorf("expected an error when the endpoint refuses the introspection query")
+	}
+}
+
+func TestIntrospectionToSDLWithoutRootTypes(t *testing.T) {
+	sdl := IntrospectionToSDL(&IntrospectionSchema{Types: []IntrospectionType{{
+		Kind:   "OBJECT",
+		Name:   "Query",
+		Fields: []IntrospectionField{{Name: "hello", Type: IntrospectionTypeRef{Kind: "SCALAR", Name: "String"}}},
+	}}})
+	schema, err := gql.LoadSchema(&ast.Source{Input: sdl})
+	if err != nil {
+		t.Fatalf("cannot load %q: %s", sdl, err)
+	}
+	if schema.Query == nil || schema.Query.Name != "Query" {
+		t.Errorf("expected Query to be the query type")
+	}
+}
@@ -0,0 +1,385 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"golang.org/x/exp/maps"
+)
+
+// SARIF levels, also used as severities
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+	SEVERITY_NOTE    = "note"
+)
+
+const (
+	LINT_ROUTE_ERROR     = "route-error"
+	LINT_ROUTE_COLLISION = "route-collision"
+	LINT_INVALID_DEFAULT = "invalid-default"
+	LINT_NESTED_INPUT    = "nested-input"
+	LINT_ANCESTOR_INPUT  = "ancestor-input"
+	LINT_AMBIGUOUS_ID    = "ambiguous-id"
+	LINT_ENTITY_KEY      = "entity-key"
+	LINT_LOOP            = "loop"
+	LINT_DEPTH_LIMIT     = "depth-limit"
+	LINT_LIST_KEY        = "list-key"
+	LINT_ARGUMENT_TYPE   = "unsupported-argument"
+	LINT_REQUIRED_TYPE   = "unsupported-required-argument"
+)
+
+// LintRule - what a rule checks, how bad it is and how to fix it.
+type LintRule struct {
+	ID          string
+	Severity    string
+	Description string
+	Suggestion  string
+}
+
+var LINT_RULES = []LintRule{
+	{LINT_ROUTE_ERROR, SEVERITY_ERROR, "Route generation failed for a field.", "Check the field exists on its parent type."},
+	{LINT_ROUTE_COLLISION, SEVERITY_ERROR, "Two fields map to routes the router can't serve together.", "Rename one of them with -route-renames, or pick a strategy with -route-collisions."},
+	{LINT_INVALID_DEFAULT, SEVERITY_ERROR, "An argument default can't be converted, it is left out of the query string defaults.", "Use a default of the argument's type, or drop it."},
+	{LINT_ARGUMENT_TYPE, SEVERITY_WARNING, "Enum and custom scalar arguments are left out of the query string.", "Use a built-in scalar argument."},
+	{LINT_REQUIRED_TYPE, SEVERITY_ERROR, "A required enum, custom scalar or input object argument can't be passed, the field and the fields below it get no route.", "Use built-in scalars for the argument and the required fields of its input object, or give them defaults."},
+	{LINT_NESTED_INPUT, SEVERITY_WARNING, "Input object fields that aren't built-in scalars can't be passed in the query string.", "Flatten the input or move the nested fields into arguments."},
+	{LINT_ANCESTOR_INPUT, SEVERITY_WARNING, "Object arguments of a field with routes below it can't be passed to those routes.", "Use scalar arguments on fields that lead to nested routes."},
+	{LINT_AMBIGUOUS_ID, SEVERITY_NOTE, "Several ID arguments, none is encoded into the path.", "Pick one with -path-keys Type.field.arg."},
+	{LINT_ENTITY_KEY, SEVERITY_WARNING, "An entity @key can't be turned into path params, the key gets no route.", "Use scalar, non list key fields."},
+	{LINT_LOOP, SEVERITY_NOTE, "Route generation stopped at a cycle.", "Fields reached again only get routes the first time round."},
+	{LINT_DEPTH_LIMIT, SEVERITY_NOTE, "Routes below this field were cut off by the depth limit.", "Raise the limit with -max-depth or -root-depth."},
+	{LINT_LIST_KEY, SEVERITY_WARNING, "A key list mode names a field that isn't a scalar of the element type.", "Use a scalar field of the list's element type."},
+}
+
+// lintRule - rule by ID.
+func lintRule(id string) LintRule {
+	for _, rule := range LINT_RULES {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return LintRule{ID: id, Severity: SEVERITY_WARNING}
+}
+
+// Diagnostic - one finding, at a schema coordinate such as Query.books(first:).
+type Diagnostic struct {
+	Rule       string
+	Severity   string
+	Coordinate string
+	Message    string
+	Suggestion string
+	Position   *ast.Position
+}
+
+// Diagnostics - findings collected while building routes, nil discards them.
+type Diagnostics struct {
+	Items []Diagnostic
+	seen  map[string]bool
+}
+
+// Add - record a finding once per rule and coordinate.
+func (d *Diagnostics) Add(rule, coordinate, message string, position *ast.Position) {
+	if d == nil {
+		return
+	}
+	if d.seen == nil {
+		d.seen = make(map[string]bool)
+	}
+	if d.seen[rule+" "+coordinate] {
+		return
+	}
+	d.seen[rule+" "+coordinate] = true
+	info := lintRule(rule)
+	d.Items = append(d.Items, Diagnostic{
+		Rule:       rule,
+		Severity:   info.Severity,
+		Coordinate: coordinate,
+		Message:    message,
+		Suggestion: info.Suggestion,
+		Position:   position,
+	})
+}
+
+// HasErrors - any error severity findings.
+func (d *Diagnostics) HasErrors() bool {
+	for _, item := range d.Items {
+		if item.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// coordinatePosition - position of Type.field or Type.field(arg:) in the
+// schema, nil if unknown.
+func coordinatePosition(schema *ast.Schema, coordinate string) *ast.Position {
+	parts := strings.SplitN(strings.TrimSuffix(coordinate, ":)"), ".", 2)
+	def := schema.Types[parts[0]]
+	if def == nil || len(parts) != 2 {
+		return nil
+	}
+	fieldName, argName, hasArg := strings.Cut(parts[1], "(")
+	field := def.Fields.ForName(fieldName)
+	if field == nil {
+		return nil
+	}
+	if hasArg {
+		if arg := field.Arguments.ForName(argName); arg != nil {
+			return arg.Position
+		}
+	}
+	return field.Position
+}
+
+// Lint - build the routes collecting diagnostics, then check the arguments of
+// every field reachable from Query. Mutations take a JSON body, so any input
+// can be passed to them.
+func Lint(schema *ast.Schema, opts *RouteOptions) *Diagnostics {
+	local := RouteOptions{}
+	if opts != nil {
+		local = *opts
+	}
+	local.Diagnostics = &Diagnostics{}
+	local.StrictRoutes = false
+	if local.Traversal == nil {
+		local.Traversal = &Traversal{}
+	}
+	diagnostics := local.Diagnostics
+
+	routeMap, _ := CreateRouteMap(schema, &local)
+
+	// fields with routes below them, their arguments are passed down
+	ancestors := make(map[string]bool)
+	for _, method := range routeMap {
+		for _, item := range method.FieldPath {
+			ancestors[strings.SplitN(item.FieldKey, "(", 2)[0]] = true
+		}
+	}
+
+	for _, cutoff := range local.Traversal.Cutoffs {
+		diagnostics.Add(LINT_DEPTH_LIMIT, cutoff.Field,
+			fmt.Sprintf("%s is deeper than %d fields below %s", cutoff.Path, cutoff.Limit, cutoff.Root),
+			coordinatePosition(schema, cutoff.Field))
+	}
+	skipped := maps.Keys(local.Traversal.Skipped)
+	sort.Strings(skipped)
+	for _, coordinate := range skipped {
+		if local.Traversal.Skipped[coordinate] != COVERAGE_LOOP {
+			continue
+		}
+		diagnostics.Add(LINT_LOOP, coordinate, fmt.Sprintf("%s leads back to a type already on the route path", coordinate),
+			coordinatePosition(schema, coordinate))
+	}
+
+	parents := []*ast.Definition{}
+	for typeName := range reachableTypes(schema, schema.Query) {
+		parents = append(parents, schema.Types[typeName])
+	}
+	sort.Slice(parents, func(i, j int) bool { return parents[i].Name < parents[j].Name })
+
+	for _, def := range parents {
+		for _, field := range def.Fields {
+			if strings.HasPrefix(field.Name, "__") || IsHiddenField(field, schema) {
+				continue
+			}
+			if !local.Contract.FieldAllowed(def.Name, field, schema) {
+				continue
+			}
+			lintArguments(def, field, schema, &local, ancestors[def.Name+"."+field.Name])
+		}
+	}
+
+	sort.SliceStable(diagnostics.Items, func(i, j int) bool {
+		return diagnostics.Items[i].Coordinate < diagnostics.Items[j].Coordinate
+	})
+	return diagnostics
+}
+
+func lintArguments(def *ast.Definition, field *ast.FieldDefinition, schema *ast.Schema, opts *RouteOptions, ancestor bool) {
+	diagnostics := opts.Diagnostics
+	ids := 0
+	for _, arg := range field.Arguments {
+		if IsHiddenArgument(arg, schema) || !opts.Contract.ArgumentAllowed(arg, schema) {
+			continue
+		}
+		coordinate := fmt.Sprintf("%s.%s(%s:)", def.Name, field.Name, arg.Name)
+		if arg.Type.Name() == "ID" && arg.Type.Elem == nil {
+			ids++
+		}
+
+		if arg.DefaultValue != nil && IsScalar(arg.Type.Name()) && arg.Type.Elem == nil {
+			if _, err := ParseDefault(arg.Type.Name(), arg.DefaultValue); err != nil {
+				diagnostics.Add(LINT_INVALID_DEFAULT, coordinate, fmt.Sprintf("default %s of %s: %s", arg.DefaultValue.String(), coordinate, err), arg.Position)
+			}
+		}
+
+		input := schema.Types[arg.Type.Name()]
+		if input == nil || IsScalar(input.Name) {
+			continue
+		}
+		if input.Kind != ast.InputObject {
+			rule := LINT_ARGUMENT_TYPE
+			if arg.Type.NonNull && arg.DefaultValue == nil {
+				rule = LINT_REQUIRED_TYPE
+			}
+			diagnostics.Add(rule, coordinate,
+				fmt.Sprintf("%s is %s %s, it can't be passed", coordinate, strings.ToLower(string(input.Kind)), input.Name), arg.Position)
+			continue
+		}
+		if arg.Type.NonNull && arg.DefaultValue == nil {
+			if inner := unsettableInputField(input, schema, opts); inner != nil {
+				diagnostics.Add(LINT_REQUIRED_TYPE, coordinate,
+					fmt.Sprintf("%s is input %s, its required field %s: %s can't be set", coordinate, input.Name, inner.Name, inner.Type.String()), arg.Position)
+			}
+		}
+		for _, inner := range input.Fields {
+			if IsHiddenField(inner, schema) || !opts.Contract.FieldAllowed(input.Name, inner, schema) {
+				continue
+			}
+			if !IsScalar(inner.Type.Name()) {
+				diagnostics.Add(LINT_NESTED_INPUT, fmt.Sprintf("%s.%s", input.Name, inner.Name),
+					fmt.Sprintf("%s.%s is %s, %s can't set it", input.Name, inner.Name, inner.Type.String(), coordinate), inner.Position)
+			}
+		}
+		if ancestor {
+			diagnostics.Add(LINT_ANCESTOR_INPUT, coordinate,
+				fmt.Sprintf("%s takes an input object, routes below %s.%s can't pass it", coordinate, def.Name, field.Name), arg.Position)
+		}
+	}
+	if ids > 1 && PathKeyArgument(field, opts) == nil {
+		diagnostics.Add(LINT_AMBIGUOUS_ID, def.Name+"."+field.Name,
+			fmt.Sprintf("%s.%s has %d ID arguments", def.Name, field.Name, ids), field.Position)
+	}
+}
+
+// WriteLintText - one line per finding, "severity rule coordinate: message".
+func WriteLintText(w io.Writer, diagnostics *Diagnostics) {
+	counts := make(map[string]int)
+	for _, item := range diagnostics.Items {
+		location := ""
+		if item.Position != nil && item.Position.Src != nil {
+			location = fmt.Sprintf(" (%s:%d)", item.Position.Src.Name, item.Position.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s%s: %s\n", item.Severity, item.Rule, item.Coordinate, location, item.Message)
+		if item.Suggestion != "" {
+			fmt.Fprintf(w, "\t\t%s\n", item.Suggestion)
+		}
+		counts[item.Severity]++
+	}
+	fmt.Fprintf(w, "\n%d errors, %d warnings, %d notes\n", counts[SEVERITY_ERROR], counts[SEVERITY_WARNING], counts[SEVERITY_NOTE])
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifText          `json:"shortDescription"`
+	Help                 sarifText          `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           sarifRegion   `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteLintSARIF - findings as a SARIF 2.1.0 log, e.g. for code scanning.
+func WriteLintSARIF(w io.Writer, diagnostics *Diagnostics) error {
+	rules := make([]sarifRule, 0, len(LINT_RULES))
+	for _, rule := range LINT_RULES {
+		rules = append(rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifText{Text: rule.Description},
+			Help:                 sarifText{Text: rule.Suggestion},
+			DefaultConfiguration: sarifConfiguration{Level: rule.Severity},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(diagnostics.Items))
+	for _, item := range diagnostics.Items {
+		location := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: item.Coordinate, Kind: "member"}},
+		}
+		if item.Position != nil && item.Position.Src != nil && item.Position.Src.Name != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: item.Position.Src.Name},
+				Region:           sarifRegion{StartLine: item.Position.Line, StartColumn: item.Position.Column},
+			}
+		}
+		results = append(results, sarifResult{
+			RuleID:    item.Rule,
+			Level:     item.Severity,
+			Message:   sarifText{Text: item.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "gemini", Rules: rules}},
+			Results: results,
+		}},
+	})
+}
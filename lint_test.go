@@ -0,0 +1,91 @@
+package gemini
+
+import (
+	"testing"
+)
+
+func TestLintUnpassableArguments(t *testing.T) {
+	schema := loadTestSchema(t, `
+scalar DateTime
+enum Order { ASC DESC }
+type Query {
+  books(order: Order!): [Book]
+  sorted(order: Order = ASC): [Book]
+  since(from: DateTime!): [Book]
+  filtered(filter: BookFilter!): [Book]
+  ordered(order: BookOrder!): [Book]
+  between(range: DateRange!): [Book]
+  paged(page: Page!): [Book]
+  library(id: ID!): Library
+}
+type Library {
+  name: String
+  shelves(order: Order!): [Shelf]
+}
+type Shelf {
+  label: String
+  books(first: Int): [Book]
+}
+type Book {
+  title: String
+}
+input BookFilter {
+  title: String
+}
+input BookOrder {
+  field: Order!
+  direction: String
+}
+input DateRange {
+  from: DateTime!
+  to: DateTime = "2030-01-01"
+}
+input Page {
+  first: Int!
+  after: String
+}
+`)
+
+	routeMap, err := CreateRouteMap(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := Lint(schema, nil)
+	rules := make(map[string]string, len(diagnostics.Items))
+	for _, item := range diagnostics.Items {
+		rules[item.Coordinate] = item.Rule
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		route bool
+		lint  string // coordinate with a LINT_REQUIRED_TYPE finding
+	}{
+		{"required enum", "/books", false, "Query.books(order:)"},
+		{"enum with default", "/sorted", true, ""},
+		{"required custom scalar", "/since", false, "Query.since(from:)"},
+		{"required input object", "/filtered", true, ""},
+		{"required input object with a required enum", "/ordered", false, "Query.ordered(order:)"},
+		{"required input object with a required custom scalar", "/between", false, "Query.between(range:)"},
+		{"required input object with required scalars", "/paged", true, ""},
+		{"nested required enum", "/library/:library_id/shelves", false, "Library.shelves(order:)"},
+		{"below a required enum", "/library/:library_id/shelves/books", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (routeMap[tt.path] != nil) != tt.route {
+				t.Errorf("expected route %s: %t", tt.path, tt.route)
+			}
+			if tt.lint != "" && rules[tt.lint] != LINT_REQUIRED_TYPE {
+				t.Errorf("expected %s for %s, got %q", LINT_REQUIRED_TYPE, tt.lint, rules[tt.lint])
+			}
+		})
+	}
+	// the input objects left are passed as objects
+	checkRouteDocuments(t, schema, routeMap)
+	if !diagnostics.HasErrors() {
+		t.Errorf("required enum and custom scalar arguments should be errors")
+	}
+}
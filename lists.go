@@ -0,0 +1,133 @@
+package gemini
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LIST_FLATTEN = "flatten" // map across the list and concatenate the results
+	LIST_INDEX   = "index"   // address one element by position, /books/0/authors
+	LIST_KEY     = "key"     // address one element by a field, /books/:books_isbn/authors
+)
+
+// ListMode - how a route path goes through a list field.
+type ListMode struct {
+	Kind string
+	Key  string // field compared with the path param in key mode
+}
+
+// ParseListModes - parse per route list modes, e.g.
+// "/books=key:isbn,/authors=index". Routes without a mode flatten.
+func ParseListModes(spec string) (map[string]ListMode, error) {
+	modes := make(map[string]ListMode)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") {
+			return nil, fmt.Errorf("list mode must be in the form /path=mode, got %s", item)
+		}
+		mode := ListMode{Kind: parts[1]}
+		if strings.HasPrefix(parts[1], LIST_KEY+":") {
+			mode = ListMode{Kind: LIST_KEY, Key: strings.TrimPrefix(parts[1], LIST_KEY+":")}
+		}
+		switch mode.Kind {
+		case LIST_FLATTEN, LIST_INDEX:
+		case LIST_KEY:
+			if mode.Key == "" {
+				return nil, fmt.Errorf("key list mode needs a field, e.g. key:isbn, got %s", item)
+			}
+		default:
+			return nil, fmt.Errorf("unknown list mode %s for %s", parts[1], parts[0])
+		}
+		modes[parts[0]] = mode
+	}
+	return modes, nil
+}
+
+// IsAddressable - the list's elements get their own path segment.
+func (m ListMode) IsAddressable() bool {
+	return m.Kind == LIST_INDEX || m.Kind == LIST_KEY
+}
+
+// NotFoundError - a list element addressed by the path does not exist.
+type NotFoundError struct {
+	Path  string
+	Value string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no element %s in %s", e.Value, e.Path)
+}
+
+// ShapeResult - pull a route's result out of the GraphQL response data,
+// following the field path through any lists. Flattened lists map across
+// their elements and concatenate the results, addressable lists pick the
+// element named by the path param in selectors.
+func ShapeResult(method *GetMethod, data map[string]interface{}, selectors map[string]string) (interface{}, error) {
+	if method.Entity != nil {
+		if method.Entity.RootField != "" {
+			return data[method.Entity.RootField], nil
+		}
+		entities, _ := data["_entities"].([]interface{})
+		if len(entities) == 0 || entities[0] == nil {
+			return nil, &NotFoundError{Path: method.Path, Value: method.Entity.TypeName}
+		}
+		return entities[0], nil
+	}
+	return shapeRecurse(data, method.FieldPath, method.OriginalField, selectors)
+}
+
+func shapeRecurse(value interface{}, path []FieldPathDetail, leaf string, selectors map[string]string) (interface{}, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		// null somewhere along the path
+		return nil, nil
+	}
+	if len(path) == 0 {
+		return obj[leaf], nil
+	}
+
+	detail := path[0]
+	next := obj[detail.Path]
+	items, isList := next.([]interface{})
+	if !isList {
+		return shapeRecurse(next, path[1:], leaf, selectors)
+	}
+
+	switch detail.ListMode.Kind {
+	case LIST_INDEX:
+		selector := selectors[detail.ListParam]
+		index, err := strconv.Atoi(selector)
+		if err != nil || index < 0 || index >= len(items) {
+			return nil, &NotFoundError{Path: detail.Path, Value: selector}
+		}
+		return shapeRecurse(items[index], path[1:], leaf, selectors)
+	case LIST_KEY:
+		selector := selectors[detail.ListParam]
+		for _, item := range items {
+			if element, ok := item.(map[string]interface{}); ok && fmt.Sprintf("%v", element[detail.ListMode.Key]) == selector {
+				return shapeRecurse(item, path[1:], leaf, selectors)
+			}
+		}
+		return nil, &NotFoundError{Path: detail.Path, Value: selector}
+	}
+
+	flattened := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		result, err := shapeRecurse(item, path[1:], leaf, selectors)
+		if err != nil {
+			return nil, err
+		}
+		if inner, ok := result.([]interface{}); ok {
+			flattened = append(flattened, inner...)
+		} else if result != nil {
+			flattened = append(flattened, result)
+		}
+	}
+	return flattened, nil
+}
@@ -0,0 +1,130 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LOCKFILE_VERSION = 1
+	DEFAULT_LOCKFILE = "gemini.lock.json"
+
+	LOCK_DRIFT_FAIL = "fail" // refuse to start
+	LOCK_DRIFT_KEEP = "keep" // also serve moved routes at their locked path
+	LOCK_DRIFT_WARN = "warn" // log and serve the generated routes
+)
+
+// Lockfile - the published REST surface, checked in next to the schema.
+type Lockfile struct {
+	Version int         `json:"version"`
+	Routes  []RouteSpec `json:"routes"`
+}
+
+// LockDriftError - generated routes break the lockfile.
+type LockDriftError struct {
+	Path    string
+	Changes []RouteChange
+}
+
+func (e *LockDriftError) Error() string {
+	lines := make([]string, 0, len(e.Changes))
+	for _, change := range e.Changes {
+		if change.Breaking {
+			lines = append(lines, fmt.Sprintf("%s %s: %s", change.Kind, change.Path, change.Detail))
+		}
+	}
+	return fmt.Sprintf("routes drifted from %s, run gemini lock -update to accept:\n  %s", e.Path, strings.Join(lines, "\n  "))
+}
+
+// ReadLockfile - load a lockfile, nil without error when it doesn't exist.
+func ReadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read lockfile %s: %s", path, err)
+	}
+	lock := &Lockfile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("cannot parse lockfile %s: %s", path, err)
+	}
+	if lock.Version != LOCKFILE_VERSION {
+		return nil, fmt.Errorf("lockfile %s has version %d, expected %d", path, lock.Version, LOCKFILE_VERSION)
+	}
+	return lock, nil
+}
+
+// WriteLockfile - write the route surface, stable order so diffs stay small.
+func WriteLockfile(path string, routes []RouteSpec) error {
+	data, err := json.MarshalIndent(Lockfile{Version: LOCKFILE_VERSION, Routes: routes}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode lockfile: %s", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write lockfile %s: %s", path, err)
+	}
+	return nil
+}
+
+// ApplyLockfile - compare the generated routes with the locked ones. Safe
+// changes are logged. Breaking ones fail, are logged, or in keep mode routes
+// that only moved are served at their locked path too, as deprecated aliases
+// of the new path. Other breaking changes can't be kept and fail.
+func ApplyLockfile(routeMap map[string]*GetMethod, lock *Lockfile, lockPath, mode string, logger logrus.FieldLogger) error {
+	changes := DiffSurfaces(lock.Routes, BuildSurface(routeMap))
+	for _, change := range changes {
+		if !change.Breaking {
+			logger.Infof("Route change not in %s: %s %s", lockPath, change.Path, change.Detail)
+		}
+	}
+	if !HasBreaking(changes) {
+		return nil
+	}
+
+	switch mode {
+	case LOCK_DRIFT_WARN:
+		for _, change := range changes {
+			if change.Breaking {
+				logger.Warnf("Route drift from %s: %s %s", lockPath, change.Path, change.Detail)
+			}
+		}
+		return nil
+	case LOCK_DRIFT_KEEP:
+	default:
+		return &LockDriftError{Path: lockPath, Changes: changes}
+	}
+
+	locked := make(map[string]RouteSpec, len(lock.Routes))
+	for _, spec := range lock.Routes {
+		locked[spec.Path] = spec
+	}
+	root := routeTrie(routeMap)
+
+	remaining := make([]RouteChange, 0)
+	for _, change := range changes {
+		if !change.Breaking {
+			continue
+		}
+		if change.Kind != CHANGE_PATH_CHANGED {
+			remaining = append(remaining, change)
+			continue
+		}
+		dep := &Deprecation{Reason: fmt.Sprintf("Moved to %s", change.To)}
+		if err := addRouteAlias(routeMap, root, change.Path, change.To, dep); err != nil {
+			logger.Warnf("Cannot keep %s: %s", change.Path, err)
+			remaining = append(remaining, change)
+			continue
+		}
+		logger.Warnf("Keeping locked route %s for %s, now also at %s", change.Path, locked[change.Path].Field, change.To)
+	}
+
+	if len(remaining) > 0 {
+		return &LockDriftError{Path: lockPath, Changes: remaining}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package gemini
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestApplyLockfile(t *testing.T) {
+	schema := loadTestSchema(t, handlerTestSchema)
+	generated, err := CreateRouteMap(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	surface := BuildSurface(generated)
+
+	// locked - the generated surface with the item route at an older path
+	moved := make([]RouteSpec, len(surface))
+	copy(moved, surface)
+	for i := range moved {
+		if moved[i].Path == "/books/:book_isbn" {
+			moved[i].Path = "/book/:book_isbn"
+		}
+	}
+	removed := append(append([]RouteSpec{}, surface...), RouteSpec{Method: "GET", Path: "/authors", Field: "Query.authors"})
+
+	tests := []struct {
+		name   string
+		locked []RouteSpec
+		mode   string
+		drift  []string // kinds of the changes in the LockDriftError
+		alias  string
+	}{
+		{"unchanged", surface, LOCK_DRIFT_FAIL, nil, ""},
+		{"moved, fail", moved, LOCK_DRIFT_FAIL, []string{CHANGE_PATH_CHANGED}, ""},
+		{"moved, warn", moved, LOCK_DRIFT_WARN, nil, ""},
+		{"moved, keep", moved, LOCK_DRIFT_KEEP, nil, "/book/:book_isbn"},
+		{"removed, keep", removed, LOCK_DRIFT_KEEP, []string{CHANGE_ROUTE_REMOVED}, ""},
+		{"removed, warn", removed, LOCK_DRIFT_WARN, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeMap, err := CreateRouteMap(schema, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ApplyLockfile(routeMap, &Lockfile{Version: LOCKFILE_VERSION, Routes: tt.locked}, DEFAULT_LOCKFILE, tt.mode, logrus.StandardLogger())
+
+			var drift *LockDriftError
+			if tt.drift == nil && err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if tt.drift != nil {
+				if !errors.As(err, &drift) {
+					t.Fatalf("expected a LockDriftError, got %v", err)
+				}
+				if len(drift.Changes) != len(tt.drift) {
+					t.Fatalf("expected %v, got %v", tt.drift, drift.Changes)
+				}
+				for i, change := range drift.Changes {
+					if change.Kind != tt.drift[i] {
+						t.Errorf("expected %s, got %s", tt.drift[i], change.Kind)
+					}
+				}
+			}
+
+			extra := len(routeMap) - len(generated)
+			if tt.alias == "" {
+				if extra != 0 {
+					t.Errorf("expected the generated routes only, got %d more", extra)
+				}
+				return
+			}
+			alias := routeMap[tt.alias]
+			if extra != 1 || alias == nil {
+				t.Fatalf("expected the locked route %s to be kept", tt.alias)
+			}
+			if alias.Deprecation == nil || alias.Deprecation.Successor != "/books/:book_isbn" {
+				t.Errorf("expected %s to be a deprecated alias of /books/:book_isbn, got %+v", tt.alias, alias.Deprecation)
+			}
+		})
+	}
+}
+
+func TestReadLockfile(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := ReadLockfile(filepath.Join(dir, DEFAULT_LOCKFILE))
+	if lock != nil || err != nil {
+		t.Errorf("expected no lockfile and no error, got %v, %v", lock, err)
+	}
+
+	path := filepath.Join(dir, "written.json")
+	routes := []RouteSpec{{Method: "GET", Path: "/books", Field: "Query.books", Selections: []string{"isbn"}}}
+	if err := WriteLockfile(path, routes); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = ReadLockfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Routes) != 1 || lock.Routes[0].Path != "/books" || lock.Routes[0].Selections[0] != "isbn" {
+		t.Errorf("expected the written routes, got %+v", lock.Routes)
+	}
+
+	outdated := filepath.Join(dir, "outdated.json")
+	if err := os.WriteFile(outdated, []byte(`{"version": 0, "routes": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLockfile(outdated); err == nil {
+		t.Errorf("expected an error for another lockfile version")
+	}
+}
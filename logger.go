@@ -0,0 +1,20 @@
+package gemini
+
+import "github.com/sirupsen/logrus"
+
+// orStandardLogger - logger, or the logrus standard logger when it is nil.
+func orStandardLogger(logger logrus.FieldLogger) logrus.FieldLogger {
+	if logger == nil {
+		return logrus.StandardLogger()
+	}
+	return logger
+}
+
+// logger - where route generation logs, RouteOptions.Logger or the logrus
+// standard logger.
+func (o *RouteOptions) logger() logrus.FieldLogger {
+	if o == nil {
+		return logrus.StandardLogger()
+	}
+	return orStandardLogger(o.Logger)
+}
@@ -0,0 +1,158 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mount - routes served under a path prefix, built from their own schema.
+// Either an API version, e.g. /v1 from a checked in snapshot and /v2 from the
+// current composition, or a separate graph with its own upstream, e.g.
+// /github and /studio from one gemini process.
+type Mount struct {
+	Prefix        string            `json:"prefix"`                  // e.g. /v1 or /github
+	Schema        string            `json:"schema,omitempty"`        // file, directory, glob or URL
+	Introspect    string            `json:"introspect,omitempty"`    // load the schema by introspecting this endpoint
+	GraphRef      string            `json:"graphRef,omitempty"`      // Studio graph@variant, APOLLO_GRAPH_REF when empty
+	CompositionID string            `json:"compositionId,omitempty"` // pin to a composition
+	LaunchID      string            `json:"launchId,omitempty"`      // pin to the composition of a launch
+	Contract      string            `json:"contract,omitempty"`      // @tag contract, -contract when empty
+	Lockfile      string            `json:"lockfile,omitempty"`      // checked like -lockfile
+	Upstream      string            `json:"upstream,omitempty"`      // GraphQL endpoint, -upstream when empty
+	Headers       map[string]string `json:"headers,omitempty"`       // sent upstream and with introspection, ${VAR} is expanded
+}
+
+// MountConfig - the file passed with -mounts, versions and separate graphs
+// are the same kind of entry and can be mixed.
+type MountConfig struct {
+	Mounts []Mount `json:"mounts"`
+}
+
+// ReadMounts - load and check the mounts config.
+func ReadMounts(path string) ([]Mount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mounts config %s: %s", path, err)
+	}
+	config := MountConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse mounts config %s: %s", path, err)
+	}
+	mounts := config.Mounts
+	if len(mounts) == 0 {
+		return nil, fmt.Errorf("mounts config %s has no mounts", path)
+	}
+	prefixes := make(map[string]bool, len(mounts))
+	for _, mount := range mounts {
+		if !strings.HasPrefix(mount.Prefix, "/") || strings.HasSuffix(mount.Prefix, "/") || strings.Contains(mount.Prefix, ":") {
+			return nil, fmt.Errorf("mount prefix must look like /v1, got %q", mount.Prefix)
+		}
+		if prefixes[mount.Prefix] {
+			return nil, fmt.Errorf("mount prefix %s is used twice", mount.Prefix)
+		}
+		for prefix := range prefixes {
+			// /api/v2/books could be either mount's route
+			if strings.HasPrefix(mount.Prefix, prefix+"/") || strings.HasPrefix(prefix, mount.Prefix+"/") {
+				return nil, fmt.Errorf("mount prefixes %s and %s overlap", prefix, mount.Prefix)
+			}
+		}
+		prefixes[mount.Prefix] = true
+		studio := mount.GraphRef != "" || mount.CompositionID != "" || mount.LaunchID != ""
+		if (mount.Schema != "" && mount.Introspect != "") || ((mount.Schema != "" || mount.Introspect != "") && studio) {
+			return nil, fmt.Errorf("mount %s sets more than one schema source", mount.Prefix)
+		}
+	}
+	return mounts, nil
+}
+
+// expandHeaders - configured headers with environment variables expanded,
+// so tokens stay out of config files.
+func expandHeaders(headers map[string]string) http.Header {
+	header := http.Header{}
+	for name, value := range headers {
+		header.Set(name, os.ExpandEnv(value))
+	}
+	return header
+}
+
+// Header - the mount's headers.
+func (m Mount) Header() http.Header {
+	return expandHeaders(m.Headers)
+}
+
+// Source - where the mount's schema comes from, a local or remote schema,
+// introspection, or Studio pinned to a composition or launch.
+func (m Mount) Source(schemaCache, apiKey, defaultGraphRef string, strictPin bool, logger logrus.FieldLogger) (SchemaSource, error) {
+	if m.Schema != "" {
+		return NewLocalSchemaSource(m.Schema, schemaCache, logger), nil
+	}
+	if m.Introspect != "" {
+		return &IntrospectionSource{URL: m.Introspect, Headers: m.Header(), Logger: logger}, nil
+	}
+	graphRef := m.GraphRef
+	if graphRef == "" {
+		graphRef = defaultGraphRef
+	}
+	graphRefParts := strings.Split(graphRef, "@")
+	if len(graphRefParts) != 2 {
+		return nil, fmt.Errorf("could not decode graph ref %q for %s", graphRef, m.Prefix)
+	}
+	return &StudioSource{
+		GraphID: graphRefParts[0],
+		Variant: graphRefParts[1],
+		APIKey:  apiKey,
+		Pin: SupergraphPin{
+			CompositionID: m.CompositionID,
+			LaunchID:      m.LaunchID,
+			Strict:        strictPin,
+		},
+		Logger: logger,
+	}, nil
+}
+
+// RouteOptions - the shared options with the mount's own contract and a
+// fresh traversal, so mounts don't see each other's cutoffs.
+func (m Mount) RouteOptions(base *RouteOptions) (*RouteOptions, error) {
+	opts := *base
+	if base.Traversal != nil {
+		opts.Traversal = &Traversal{MaxDepth: base.Traversal.MaxDepth, RootDepth: base.Traversal.RootDepth}
+	}
+	if m.Contract != "" {
+		contract, err := ParseContract(m.Contract)
+		if err != nil {
+			return nil, fmt.Errorf("invalid contract for %s: %s", m.Prefix, err)
+		}
+		opts.Contract = contract
+	}
+	return &opts, nil
+}
+
+// NewUpstream - the mount's own upstream, or the shared one.
+func (m Mount) NewUpstream(shared *Upstream) *Upstream {
+	if m.Upstream == "" {
+		return shared
+	}
+	return NewUpstream(m.Upstream, m.Header())
+}
+
+// MountRoutes - the routes of a route map under a prefix, the handler finds
+// routes by their full path so each route is copied with it.
+func MountRoutes(routeMap map[string]*GetMethod, prefix string) map[string]*GetMethod {
+	mounted := make(map[string]*GetMethod, len(routeMap))
+	for path, method := range routeMap {
+		prefixed := *method
+		prefixed.Path = prefix + path
+		if method.Deprecation != nil && method.Deprecation.Successor != "" {
+			deprecation := *method.Deprecation
+			deprecation.Successor = prefix + deprecation.Successor
+			prefixed.Deprecation = &deprecation
+		}
+		mounted[prefixed.Path] = &prefixed
+	}
+	return mounted
+}
@@ -0,0 +1,165 @@
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadMounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		prefixes []string
+		err      bool
+	}{
+		{
+			name:     "versions and graphs",
+			config:   `{"mounts": [{"prefix": "/v1", "schema": "v1.graphqls"}, {"prefix": "/github", "schema": "github.graphqls", "upstream": "https://api.github.com/graphql"}]}`,
+			prefixes: []string{"/v1", "/github"},
+		},
+		{name: "no mounts", config: `{"mounts": []}`, err: true},
+		{name: "trailing slash", config: `{"mounts": [{"prefix": "/v1/"}]}`, err: true},
+		{name: "path param", config: `{"mounts": [{"prefix": "/:version"}]}`, err: true},
+		{name: "prefix used twice", config: `{"mounts": [{"prefix": "/v1"}, {"prefix": "/v1"}]}`, err: true},
+		{name: "graph inside a version", config: `{"mounts": [{"prefix": "/api"}, {"prefix": "/api/github"}]}`, err: true},
+		{name: "version around a graph", config: `{"mounts": [{"prefix": "/api/github"}, {"prefix": "/api"}]}`, err: true},
+		{name: "shared start only", config: `{"mounts": [{"prefix": "/api"}, {"prefix": "/api2"}]}`, prefixes: []string{"/api", "/api2"}},
+		{name: "two schema sources", config: `{"mounts": [{"prefix": "/v1", "schema": "v1.graphqls", "compositionId": "a1b2c3"}]}`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mounts.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mounts, err := ReadMounts(path)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if len(mounts) != len(tt.prefixes) {
+				t.Fatalf("expected %v, got %v", tt.prefixes, mounts)
+			}
+			for i, mount := range mounts {
+				if mount.Prefix != tt.prefixes[i] {
+					t.Errorf("expected %s, got %s", tt.prefixes[i], mount.Prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestMountRoutes(t *testing.T) {
+	schema := loadTestSchema(t, handlerTestSchema)
+	routeMap, err := CreateRouteMap(schema, &RouteOptions{Aliases: map[string]string{"/book/:book_isbn": "/books/:book_isbn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := NewRouteHandler(MountRoutes(routeMap, "/v1"), nil, nil)
+
+	for _, path := range []string{"/v1/books", "/v1/books/:book_isbn", "/v1/book/:book_isbn"} {
+		if v1.Routes[path] == nil {
+			t.Errorf("missing route %s", path)
+		}
+	}
+	if alias := v1.Routes["/v1/book/:book_isbn"]; alias != nil && alias.Deprecation.Successor != "/v1/books/:book_isbn" {
+		t.Errorf("expected the alias to point at /v1/books/:book_isbn, got %s", alias.Deprecation.Successor)
+	}
+	if status, _ := serveTest(t, v1, "/books/1"); status != 404 {
+		t.Errorf("expected routes outside the prefix to be missing, got %d", status)
+	}
+}
+
+// mountUpstream - upstream answering every request with body, recording the
+// Authorization header it was sent.
+func mountUpstream(t *testing.T, body string, authorization *string) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestMountSideBySide(t *testing.T) {
+	dir := t.TempDir()
+	githubSchema := `
+type Query {
+  repository(owner: String!, name: String!): Repository
+}
+type Repository {
+  name: String
+  stars: Int
+}
+`
+	for name, sdl := range map[string]string{"v1.graphqls": handlerTestSchema, "github.graphqls": githubSchema} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sdl), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sharedAuth, githubAuth string
+	shared := mountUpstream(t, `{"data":{"book":{"isbn":"1","title":"Dune"}}}`, &sharedAuth)
+	github := mountUpstream(t, `{"data":{"repository":{"name":"gemini","stars":5}}}`, &githubAuth)
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	config, _ := json.Marshal(MountConfig{Mounts: []Mount{
+		{Prefix: "/v1", Schema: filepath.Join(dir, "v1.graphqls")},
+		{Prefix: "/github", Schema: filepath.Join(dir, "github.graphqls"), Upstream: github.URL,
+			Headers: map[string]string{"Authorization": "Bearer ${GITHUB_TOKEN}"}},
+	}})
+	path := filepath.Join(dir, "mounts.json")
+	if err := os.WriteFile(path, config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mounts, err := ReadMounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one handler per mount, like serving -mounts
+	mux := http.NewServeMux()
+	for _, mount := range mounts {
+		source, err := mount.Source("", "", "", false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema, err := LoadSchema(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts, err := mount.RouteOptions(&RouteOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		routeMap, err := CreateRouteMap(schema, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.Handle(mount.Prefix+"/", NewRouteHandler(MountRoutes(routeMap, mount.Prefix), mount.NewUpstream(NewUpstream(shared.URL, nil)), nil))
+	}
+
+	// each prefix reaches its own upstream
+	status, body := serveTest(t, mux, "/v1/books/1")
+	if status != 200 || body["title"] != "Dune" || sharedAuth != "" {
+		t.Errorf("expected the book from the shared upstream without auth, got %d %v, %q", status, body, sharedAuth)
+	}
+	status, body = serveTest(t, mux, "/github/repository?owner=a&name=gemini")
+	if status != 200 || body["name"] != "gemini" || githubAuth != "Bearer secret" {
+		t.Errorf("expected the repository from the github upstream with its token, got %d %v, %q", status, body, githubAuth)
+	}
+
+	// routes only exist under the mount whose schema has them
+	if status, _ := serveTest(t, mux, "/github/books/1"); status != 404 {
+		t.Errorf("expected /github/books/1 to be missing, got %d", status)
+	}
+	if status, _ := serveTest(t, mux, "/v1/repository?owner=a&name=b"); status != 404 {
+		t.Errorf("expected /v1/repository to be missing, got %d", status)
+	}
+}
@@ -1,44 +1,89 @@
-package main
+package gemini
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/v2/ast"
 	"golang.org/x/exp/maps"
 )
 
 const (
-	MAX_PATH_DEPTH = 3
+	MAX_PATH_DEPTH = 3 // default depth below a root field, see Traversal
 )
 
 type TypeSignature struct {
 	Type     string
+	GQLType  string // full GraphQL type for variable declarations, e.g. [ID!]!
+	List     bool   // comma separated in the query string
 	Default  interface{}
 	Required bool
 }
 
 type FieldPathDetail struct {
-	Path     string
-	IDInPath bool
+	Path      string
+	FieldKey  string // parent type, field and arguments, for cycle detection
+	Type      string // named type the field returns
+	IDInPath  bool
+	Key       PathKey // argument encoded into the path when IDInPath
+	Args      []PrefixedArg
+	List      bool     // the field returns a list
+	ListMode  ListMode // how the path goes through the list
+	ListParam string   // path param selecting an element, index and key modes
+}
+
+// PrefixedArg - argument of a field other than the route's own field,
+// exposed as a prefixed query string parameter, e.g. library.filter for an
+// ancestor or _args.issues.first for an included field.
+type PrefixedArg struct {
+	Arg      string // argument name on the field
+	Param    string // query string name, e.g. library.filter
+	Variable string // GraphQL variable, e.g. library__filter
+	Sig      TypeSignature
+}
+
+// IncludeField - field with arguments that can be added to a route's
+// selection with ?_include=, rather than only being reachable on its own route.
+type IncludeField struct {
+	Field       string
+	Args        []PrefixedArg
+	Selections  []string
+	Deprecation *Deprecation // deprecated scalars are only selected when included
+}
+
+// PathKey - an argument looked up through a named path parameter.
+type PathKey struct {
+	Arg   string // argument name, e.g. id or isbn
+	Param string // path parameter and variable name, e.g. library_id
+	Type  string // GraphQL type of the argument, e.g. ID!
 }
 
 type GetMethod struct {
 	Path             string                   // path for REST router
 	Method           string                   // GET/POST
 	IDInPath         bool                     // Whether the ID is encoded into path
+	Key              PathKey                  // the ID argument when IDInPath
 	QueryString      map[string]TypeSignature // for validating QS
+	RequiredInputs   []string                 // required input object arguments, passed even when none of their fields are given
 	GQLQuery         string                   // name of the underlying GQL query
 	ResultSelections []string                 // What is the full selection set of the GQL response
 	OriginalField    string
-	FieldPath        []FieldPathDetail // parent type path for this field
+	FieldPath        []FieldPathDetail        // parent type path for this field
+	Subgraphs        []string                 // subgraphs resolving the field, supergraphs only
+	PathParams       []string                 // named path parameters copied into variables
+	PathParamTypes   map[string]TypeSignature // for coercing path parameters, e.g. an Int key
+	Entity           *EntityLookup            // set for entity routes built from @key
+	TypeSelections   map[string][]string      // per concrete type selections for interface/union results
+	Includes         map[string]*IncludeField // fields with arguments selectable with ?_include=
+	Deprecation      *Deprecation             // set for deprecated fields and aliases
 }
 
 type PostMethod struct{}
 
 // MakeTypeSig - create type sig object with stored default values
-func MakeTypeSig(name, typeName string, required bool, defaultValue *ast.Value) TypeSignature {
+func MakeTypeSig(name, typeName string, required bool, defaultValue *ast.Value, opts *RouteOptions) TypeSignature {
 
 	ts := TypeSignature{
 		Type:     typeName,
@@ -46,64 +91,264 @@ func MakeTypeSig(name, typeName string, required bool, defaultValue *ast.Value)
 	}
 	// parse default value and convert to interface
 	if defaultValue != nil {
-		switch typeName {
-		case "ID":
-			fallthrough
-		case "String":
-			ts.Default = defaultValue.Raw
-		case "Int":
-			i, err := strconv.ParseInt(defaultValue.Raw, 10, 64)
-			if err != nil {
-				log.Warnf("Cannot parse input default for %s: %s", name, err)
-			} else {
-				ts.Default = i
-			}
-		case "Float":
-			i, err := strconv.ParseFloat(defaultValue.Raw, 64)
-			if err != nil {
-				log.Warnf("Cannot parse input default for %s: %s", name, err)
-			} else {
-				ts.Default = i
-			}
-		case "Boolean":
-			i, err := strconv.ParseBool(defaultValue.Raw)
-			if err != nil {
-				log.Warnf("Cannot parse input default for %s: %s", name, err)
-			} else {
-				ts.Default = i
-			}
-		default:
-			log.Warnf("Unknown default value type: %s", typeName)
+		value, err := ParseDefault(typeName, defaultValue)
+		if err != nil {
+			opts.logger().Warnf("Cannot parse input default for %s: %s", name, err)
+		} else {
+			ts.Default = value
 		}
 	}
 	return ts
 }
 
-func FlattenInput(parent string, input *ast.ArgumentDefinition, schema *ast.Schema) map[string]TypeSignature {
+// ParseDefault - convert an argument default to a variable value, only
+// built-in scalars are supported.
+func ParseDefault(typeName string, defaultValue *ast.Value) (interface{}, error) {
+	if defaultValue.Kind == ast.NullValue {
+		return nil, nil
+	}
+	switch typeName {
+	case "ID", "String":
+		return defaultValue.Raw, nil
+	case "Int":
+		return strconv.ParseInt(defaultValue.Raw, 10, 64)
+	case "Float":
+		return strconv.ParseFloat(defaultValue.Raw, 64)
+	case "Boolean":
+		return strconv.ParseBool(defaultValue.Raw)
+	}
+	return nil, fmt.Errorf("unknown default value type: %s", typeName)
+}
+
+// FlattenInput - query string params for the scalar fields of an input
+// object argument, e.g. filter.title. Inaccessible fields and fields left out
+// of the contract can't be set.
+func FlattenInput(parent string, input *ast.ArgumentDefinition, schema *ast.Schema, opts *RouteOptions) map[string]TypeSignature {
 	ret := make(map[string]TypeSignature)
 
 	def := schema.Types[input.Type.Name()]
 	for _, field := range def.Fields {
+		if IsHiddenField(field, schema) || !opts.Contract.FieldAllowed(def.Name, field, schema) {
+			continue
+		}
 		if IsScalar(field.Type.Name()) {
 			flatName := fmt.Sprintf("%s.%s", parent, field.Name)
-			ret[flatName] = MakeTypeSig(flatName, field.Type.Name(), field.Type.NonNull, nil)
+			ts := MakeTypeSig(flatName, field.Type.Name(), field.Type.NonNull, nil, opts)
+			ts.GQLType = field.Type.String()
+			ts.List = field.Type.Elem != nil
+			ret[flatName] = ts
 		} else {
-			log.Warnf("nested input types not supported at this time")
+			opts.logger().Warnf("nested input types not supported at this time")
 		}
 	}
 	return ret
 }
 
-func CreateGetMethod(name, parentPath, parentType string, parentFieldPath []FieldPathDetail, schema *ast.Schema) ([]*GetMethod, error) {
-	return createGetMethodInner(name, parentPath, parentType, parentFieldPath, schema)
+// keySig - type signature of a path key, path keys are always required.
+func keySig(key PathKey, opts *RouteOptions) TypeSignature {
+	ts := MakeTypeSig(key.Param, strings.TrimSuffix(key.Type, "!"), true, nil, opts)
+	ts.GQLType = key.Type
+	return ts
 }
 
-func createGetMethodInner(name, parentPath, parentType string, parentFieldPath []FieldPathDetail, schema *ast.Schema) ([]*GetMethod, error) {
+// PathKeyArgument - the argument of a field that is encoded into the path.
+// Arguments configured as path keys win, otherwise a single ID argument is
+// used, e.g. author(id: ID!) or book(isbn: ID!).
+func PathKeyArgument(field *ast.FieldDefinition, opts *RouteOptions) *ast.ArgumentDefinition {
+	for _, arg := range field.Arguments {
+		if opts.PathKeys[arg.Name] || opts.PathKeys[field.Name+"."+arg.Name] {
+			if IsScalar(arg.Type.Name()) && arg.Type.Elem == nil {
+				return arg
+			}
+		}
+	}
 
-	if len(parentFieldPath) > MAX_PATH_DEPTH {
-		log.Warnf("createGetMethodInner: Max depth exceeded: %s/%s", parentPath, name)
-		return nil, nil
+	var idArg *ast.ArgumentDefinition
+	for _, arg := range field.Arguments {
+		if arg.Type.Name() == "ID" && arg.Type.Elem == nil {
+			if idArg != nil {
+				// ambiguous, leave both in the query string
+				return nil
+			}
+			idArg = arg
+		}
+	}
+	return idArg
+}
+
+// unpassableArgument - a required argument without default the query string
+// can't carry, an enum or custom scalar, or an input object with a required
+// field that can't be flattened into input.field. Fields taking one can't be
+// queried, so they get no route and neither do the fields below them.
+func unpassableArgument(field *ast.FieldDefinition, schema *ast.Schema, opts *RouteOptions) *ast.ArgumentDefinition {
+	for _, arg := range field.Arguments {
+		if !arg.Type.NonNull || arg.DefaultValue != nil || IsScalar(arg.Type.Name()) {
+			continue
+		}
+		if def := schema.Types[arg.Type.Name()]; def != nil && def.Kind == ast.InputObject &&
+			unsettableInputField(def, schema, opts) == nil {
+			// flattened into input.field
+			continue
+		}
+		return arg
+	}
+	return nil
+}
+
+// unsettableInputField - a required field of an input object the query
+// string can't set, e.g. field: RepositoryOrderField! in RepositoryOrder.
+func unsettableInputField(def *ast.Definition, schema *ast.Schema, opts *RouteOptions) *ast.FieldDefinition {
+	for _, field := range def.Fields {
+		if !field.Type.NonNull || field.DefaultValue != nil {
+			continue
+		}
+		if !IsScalar(field.Type.Name()) || IsHiddenField(field, schema) || !opts.Contract.FieldAllowed(def.Name, field, schema) {
+			return field
+		}
+	}
+	return nil
+}
+
+// isResourcePath - path is a collection an item field was merged into.
+func isResourcePath(path string, opts *RouteOptions) bool {
+	for _, resourcePath := range opts.resourcePaths {
+		if resourcePath == path {
+			return true
+		}
 	}
+	return false
+}
+
+// reentersType - typeName is the root type or returned by a field already on
+// the path, e.g. Repository.owner -> RepositoryOwner.repository -> Repository.
+func reentersType(typeName, parentType string, parentFieldPath []FieldPathDetail) bool {
+	if typeName == parentType {
+		return true
+	}
+	for i, item := range parentFieldPath {
+		if item.Type == typeName || (i == 0 && strings.HasPrefix(item.FieldKey, typeName+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// PathParamName - name of the path parameter for a field's key argument,
+// e.g. library(id:) -> library_id. Names are derived from the field so the
+// same field always uses the same parameter, as the router requires.
+func PathParamName(fieldName, argName string) string {
+	return fmt.Sprintf("%s_%s", ToSnakeCase(fieldName), ToSnakeCase(argName))
+}
+
+// ancestorArguments - scalar arguments of a field, other than its path key,
+// as seen by routes nested below it.
+func ancestorArguments(field *ast.FieldDefinition, keyArg *ast.ArgumentDefinition, schema *ast.Schema, opts *RouteOptions) []PrefixedArg {
+	args := make([]PrefixedArg, 0, len(field.Arguments))
+	for _, input := range field.Arguments {
+		if input == keyArg || IsHiddenArgument(input, schema) || !opts.Contract.ArgumentAllowed(input, schema) {
+			continue
+		}
+		if !IsScalar(input.Type.Name()) {
+			opts.logger().Warnf("Non scalar argument %s.%s can't be passed to nested routes", field.Name, input.Name)
+			continue
+		}
+		ts := MakeTypeSig(input.Name, input.Type.Name(), input.Type.NonNull, input.DefaultValue, opts)
+		ts.GQLType = input.Type.String()
+		ts.List = input.Type.Elem != nil
+		args = append(args, PrefixedArg{
+			Arg:      input.Name,
+			Param:    fmt.Sprintf("%s.%s", field.Name, input.Name),
+			Variable: fmt.Sprintf("%s__%s", field.Name, input.Name),
+			Sig:      ts,
+		})
+	}
+	return args
+}
+
+// includeField - describe a field with arguments for ?_include=, nil when
+// a required argument can't be passed in the query string.
+func includeField(field *ast.FieldDefinition, schema *ast.Schema, opts *RouteOptions) *IncludeField {
+	include := &IncludeField{
+		Field: field.Name,
+		Args:  make([]PrefixedArg, 0, len(field.Arguments)),
+	}
+	for _, input := range field.Arguments {
+		hidden := IsHiddenArgument(input, schema) || !opts.Contract.ArgumentAllowed(input, schema)
+		if hidden || !IsScalar(input.Type.Name()) {
+			if input.Type.NonNull && input.DefaultValue == nil {
+				return nil
+			}
+			continue
+		}
+		ts := MakeTypeSig(input.Name, input.Type.Name(), input.Type.NonNull, input.DefaultValue, opts)
+		ts.GQLType = input.Type.String()
+		ts.List = input.Type.Elem != nil
+		include.Args = append(include.Args, PrefixedArg{
+			Arg:      input.Name,
+			Param:    fmt.Sprintf("_args.%s.%s", field.Name, input.Name),
+			Variable: fmt.Sprintf("include__%s__%s", field.Name, input.Name),
+			Sig:      ts,
+		})
+	}
+	if def := schema.Types[field.Type.Name()]; def != nil && !IsScalar(def.Name) {
+		include.Selections = nestedSelections(def, schema, opts, 1)
+		if len(include.Selections) == 0 {
+			return nil
+		}
+	}
+	return include
+}
+
+// nestedSelections - scalars of a type plus, down to depth levels, the
+// scalars of its object fields that take no arguments, e.g. for a connection
+// "totalCount" and "nodes { id title }".
+func nestedSelections(def *ast.Definition, schema *ast.Schema, opts *RouteOptions, depth int) []string {
+	selections := scalarSelections(def, schema, opts)
+	if depth == 0 {
+		return selections
+	}
+	for _, field := range def.Fields {
+		if strings.HasPrefix(field.Name, "__") || len(field.Arguments) > 0 || IsScalar(field.Type.Name()) {
+			continue
+		}
+		if IsHiddenField(field, schema) || !opts.Contract.FieldAllowed(def.Name, field, schema) {
+			continue
+		}
+		inner := schema.Types[field.Type.Name()]
+		if inner == nil || (inner.Kind != ast.Object && inner.Kind != ast.Interface) {
+			continue
+		}
+		if innerSelections := nestedSelections(inner, schema, opts, depth-1); len(innerSelections) > 0 {
+			selections = append(selections, fmt.Sprintf("%s { %s }", field.Name, strings.Join(innerSelections, " ")))
+		}
+	}
+	return selections
+}
+
+// fieldType - named type of a field, empty if the type has no such field.
+func fieldType(def *ast.Definition, name string) string {
+	if field := def.Fields.ForName(name); field != nil {
+		return field.Type.Name()
+	}
+	return ""
+}
+
+// childFieldPath - copy of the parent path with one more element, children
+// must not share a backing array with their siblings.
+func childFieldPath(parentFieldPath []FieldPathDetail, detail FieldPathDetail) []FieldPathDetail {
+	path := make([]FieldPathDetail, 0, len(parentFieldPath)+1)
+	path = append(path, parentFieldPath...)
+	return append(path, detail)
+}
+
+func CreateGetMethod(name, parentPath, parentType string, parentFieldPath []FieldPathDetail, schema *ast.Schema, opts *RouteOptions) ([]*GetMethod, error) {
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+	return createGetMethodInner(name, parentPath, parentType, parentFieldPath, schema, opts)
+}
+
+func createGetMethodInner(name, parentPath, parentType string, parentFieldPath []FieldPathDetail, schema *ast.Schema, opts *RouteOptions) ([]*GetMethod, error) {
 
 	var queryField *ast.FieldDefinition
 	if parentType == "Query" {
@@ -123,86 +368,219 @@ func createGetMethodInner(name, parentPath, parentType string, parentFieldPath [
 		}
 	}
 
+	if queryField == nil {
+		return nil, fmt.Errorf("could not find query %s in schema", name)
+	}
+
+	if IsHiddenField(queryField, schema) {
+		opts.logger().Debugf("Field %s.%s is inaccessible, skipping", parentType, name)
+		return nil, nil
+	}
+	if arg := unpassableArgument(queryField, schema, opts); arg != nil {
+		opts.logger().Warnf("Field %s.%s requires %s: %s, which can't be passed, skipping", parentType, name, arg.Name, arg.Type.String())
+		opts.Traversal.skip(parentType+"."+name, COVERAGE_INPUT)
+		return nil, nil
+	}
+
+	fieldKey := FieldKey(parentType, queryField)
 	if parentFieldPath == nil {
 		parentFieldPath = make([]FieldPathDetail, 0)
 	} else {
-		// naive detect cycle TODO - use type/param
 		for _, item := range parentFieldPath {
-			if item.Path == name {
-				log.Debugf("Detected loop (%s), returning...", item)
+			if item.FieldKey == fieldKey {
+				opts.logger().Debugf("Detected loop (%s), returning...", fieldKey)
+				opts.Traversal.skip(parentType+"."+name, COVERAGE_LOOP)
 				return nil, nil
 			}
 		}
+		root := parentFieldPath[0].Path
+		if len(parentFieldPath) > opts.Traversal.Limit(root) {
+			opts.logger().Debugf("createGetMethodInner: Max depth exceeded: %s/%s", parentPath, name)
+			opts.Traversal.cutoff(root, fmt.Sprintf("%s/%s", parentPath, ToSnakeCase(name)), parentType+"."+name)
+			return nil, nil
+		}
 	}
 
-	if queryField == nil {
-		return nil, fmt.Errorf("could not find query %s in schema", name)
+	segment := ToSnakeCase(queryField.Name)
+	if rename, ok := opts.Renames[parentType+"."+name]; ok {
+		segment = rename
+	}
+	newPath := fmt.Sprintf("%s/%s", parentPath, segment)
+	if resourcePath, ok := opts.resourcePaths[name]; ok && parentType == "Query" {
+		newPath = resourcePath
 	}
 
-	newPath := fmt.Sprintf("%s/%s", parentPath, ToSnakeCase(queryField.Name))
+	// elements of an addressable list get routes for their object fields too,
+	// e.g. /books/:books_isbn/authors
+	listItem := len(parentFieldPath) > 0 && parentFieldPath[len(parentFieldPath)-1].ListMode.IsAddressable()
 
 	var sig *GetMethod
 
-	if (parentType == "Query") || len(queryField.Arguments) > 0 {
+	if (parentType == "Query") || len(queryField.Arguments) > 0 || listItem {
 		sig = &GetMethod{
 			OriginalField: name,
 			Path:          newPath,
 			Method:        "GET",
 			QueryString:   make(map[string]TypeSignature, len(queryField.Arguments)),
 			FieldPath:     parentFieldPath,
+			Subgraphs:     SubgraphsForField(parentType, queryField, schema),
+			Deprecation:   routeDeprecation(parentType, queryField, parentFieldPath, schema, opts),
 		}
 	}
 
 	idInPath := false
+	var key PathKey
+	keyArg := PathKeyArgument(queryField, opts)
 
 	// handle input arguments
 	for _, input := range queryField.Arguments {
-		log.Infof("Type: name: %s, named type: %s", input.Name, input.Type.Name())
+		if IsHiddenArgument(input, schema) || !opts.Contract.ArgumentAllowed(input, schema) {
+			continue
+		}
+		opts.logger().Infof("Type: name: %s, named type: %s", input.Name, input.Type.Name())
 
 		// Try to encode ID into path to be more RESTy
-		if (input.Name == "id") && (input.Type.Name() == "ID") {
+		if input == keyArg {
 			idInPath = true
+			key = PathKey{
+				Arg:   input.Name,
+				Param: PathParamName(queryField.Name, input.Name),
+				Type:  input.Type.String(),
+			}
 			sig.IDInPath = true
-			sig.Path = fmt.Sprintf("%s/:id", newPath)
+			sig.Key = key
+			sig.Path = fmt.Sprintf("%s/:%s", newPath, key.Param)
 			newPath = sig.Path
 		} else {
 			// If the input is a scalar, map it into the QS args.
 			if IsScalar(input.Type.Name()) {
-				sig.QueryString[input.Name] = MakeTypeSig(input.Name, input.Type.Name(), input.Type.NonNull, input.DefaultValue)
+				ts := MakeTypeSig(input.Name, input.Type.Name(), input.Type.NonNull, input.DefaultValue, opts)
+				ts.GQLType = input.Type.String()
+				ts.List = input.Type.Elem != nil
+				sig.QueryString[input.Name] = ts
+			} else if def := schema.Types[input.Type.Name()]; def.Kind == ast.InputObject && unsettableInputField(def, schema, opts) != nil {
+				// the object can't be passed without its required fields
+				opts.logger().Warnf("Input %s of %s has required fields the query string can't set, leaving it out", input.Name, queryField.Name)
 			} else {
 				// otherwise flatten the input using dot notation
-				log.Infof("Non scalar input, flattening...")
-				typeMap := FlattenInput(input.Name, input, schema)
+				opts.logger().Infof("Non scalar input, flattening...")
+				typeMap := FlattenInput(input.Name, input, schema, opts)
 				maps.Copy(sig.QueryString, typeMap)
+				if input.Type.NonNull && input.DefaultValue == nil {
+					sig.RequiredInputs = append(sig.RequiredInputs, input.Name)
+				}
 			}
 
 		}
 	}
 
+	if sig != nil {
+		// every ID in the path, ancestors first, becomes a variable
+		sig.PathParamTypes = make(map[string]TypeSignature)
+		for _, item := range parentFieldPath {
+			if item.IDInPath {
+				sig.PathParams = append(sig.PathParams, item.Key.Param)
+				sig.PathParamTypes[item.Key.Param] = keySig(item.Key, opts)
+			}
+		}
+		if idInPath {
+			sig.PathParams = append(sig.PathParams, key.Param)
+			sig.PathParamTypes[key.Param] = keySig(key, opts)
+		}
+	}
+
 	sigs := make([]*GetMethod, 0, 10)
 	if sig != nil {
 		sigs = append(sigs, sig)
 	}
 
+	// the route for a field returning a type already on the path is kept with
+	// its own selections, descending into it again would only repeat the
+	// routes above it
+	loop := !IsScalar(queryField.Type.Name()) && reentersType(queryField.Type.Name(), parentType, parentFieldPath)
+	if loop {
+		opts.logger().Debugf("Detected loop (%s re-enters %s), not descending", fieldKey, queryField.Type.Name())
+		opts.Traversal.skip(parentType+"."+name, COVERAGE_LOOP)
+		if sig == nil {
+			return sigs, nil
+		}
+	}
+
 	if !IsScalar(queryField.Type.Name()) {
 		// Here we need to decend into the return type to look for fields that take arguments
 		// each of those will become it's own REST route.
 		def := schema.Types[queryField.Type.Name()]
 
+		// children see this field as an ancestor, along with its arguments
+		detail := FieldPathDetail{
+			Path:     queryField.Name,
+			FieldKey: fieldKey,
+			Type:     queryField.Type.Name(),
+			IDInPath: idInPath,
+			Key:      key,
+			Args:     ancestorArguments(queryField, keyArg, schema, opts),
+		}
+
+		if queryField.Type.Elem != nil {
+			detail.List = true
+			detail.ListMode = opts.ListModes[newPath]
+			if detail.ListMode.Kind == LIST_KEY && !IsScalar(fieldType(def, detail.ListMode.Key)) {
+				opts.logger().Warnf("List key %s is not a scalar field of %s, flattening %s", detail.ListMode.Key, def.Name, newPath)
+				opts.Diagnostics.Add(LINT_LIST_KEY, parentType+"."+name,
+					fmt.Sprintf("list key %s is not a scalar field of %s, %s is flattened", detail.ListMode.Key, def.Name, newPath), queryField.Position)
+				detail.ListMode = ListMode{}
+			}
+			if detail.ListMode.IsAddressable() && parentType == "Query" && isResourcePath(newPath, opts) {
+				// the item field already owns /<collection>/:param
+				opts.logger().Warnf("%s is merged with its item field, flattening instead of %s", newPath, detail.ListMode.Kind)
+				detail.ListMode = ListMode{}
+			}
+			if detail.ListMode.Kind == "" {
+				detail.ListMode.Kind = LIST_FLATTEN
+			}
+			if detail.ListMode.IsAddressable() {
+				param := detail.ListMode.Key
+				if detail.ListMode.Kind == LIST_INDEX {
+					param = "index"
+				}
+				detail.ListParam = PathParamName(queryField.Name, param)
+				newPath = fmt.Sprintf("%s/:%s", newPath, detail.ListParam)
+			}
+		}
+
 		for _, field := range def.Fields {
-			// Fields with arguments must be represented by a different REST op
-			// without some acrobatics in the way we represent query string parameters,
-			// would need some kind of prefixing.
-			if (len(field.Arguments) > 0) && ((len(queryField.Arguments) == 0) || (idInPath && (len(queryField.Arguments) == 1))) {
-				innerSigs, _ := createGetMethodInner(
+			if strings.HasPrefix(field.Name, "__") || IsHiddenField(field, schema) {
+				continue
+			}
+			if !opts.Contract.FieldAllowed(def.Name, field, schema) {
+				continue
+			}
+			// Fields with arguments must be represented by a different REST op,
+			// the arguments of their ancestors are passed as prefixed query
+			// string parameters.
+			if len(field.Arguments) > 0 {
+				if sig != nil {
+					if include := includeField(field, schema, opts); include != nil {
+						if sig.Includes == nil {
+							sig.Includes = make(map[string]*IncludeField)
+						}
+						sig.Includes[field.Name] = include
+					}
+				}
+				if loop {
+					continue
+				}
+
+				innerSigs, err := createGetMethodInner(
 					field.Name,
 					newPath,
 					queryField.Type.Name(),
-					append(parentFieldPath, FieldPathDetail{
-						Path:     queryField.Name,
-						IDInPath: idInPath,
-					}),
-					schema)
+					childFieldPath(parentFieldPath, detail),
+					schema,
+					opts)
+				if err != nil {
+					opts.Diagnostics.Add(LINT_ROUTE_ERROR, def.Name+"."+field.Name, err.Error(), field.Position)
+				}
 
 				if innerSigs != nil {
 					sigs = append(sigs, innerSigs...)
@@ -210,26 +588,33 @@ func createGetMethodInner(name, parentPath, parentType string, parentFieldPath [
 
 			} else {
 				if IsScalar(field.Type.Name()) {
-					if sig != nil {
+					if dep := fieldDeprecation(def.Name, field, opts); dep != nil && sig != nil {
+						// still selectable with ?_include=
+						if sig.Includes == nil {
+							sig.Includes = make(map[string]*IncludeField)
+						}
+						sig.Includes[field.Name] = &IncludeField{Field: field.Name, Deprecation: dep}
+					} else if sig != nil {
 						if sig.ResultSelections == nil {
 							sig.ResultSelections = make([]string, 0, len(def.Fields))
 						}
 						sig.ResultSelections = append(sig.ResultSelections, field.Name)
 					}
 
-				} else {
+				} else if !loop {
 					// This case is no arguments to the field and it's non-scalar
 					// so we should search up through the tree to find terminal
 					// nodes that will become their own REST routes.
-					innerSigs, _ := createGetMethodInner(
+					innerSigs, err := createGetMethodInner(
 						field.Name,
 						newPath,
 						queryField.Type.Name(),
-						append(parentFieldPath, FieldPathDetail{
-							Path:     queryField.Name,
-							IDInPath: idInPath,
-						}),
-						schema)
+						childFieldPath(parentFieldPath, detail),
+						schema,
+						opts)
+					if err != nil {
+						opts.Diagnostics.Add(LINT_ROUTE_ERROR, def.Name+"."+field.Name, err.Error(), field.Position)
+					}
 
 					if innerSigs != nil {
 						sigs = append(sigs, innerSigs...)
@@ -239,6 +624,18 @@ func createGetMethodInner(name, parentPath, parentType string, parentFieldPath [
 			}
 		}
 
+		if sig != nil && (def.Kind == ast.Interface || def.Kind == ast.Union) {
+			addTypeSelections(sig, def, schema, opts)
+		}
+		if sig != nil && def.Kind != ast.Enum && def.Kind != ast.Scalar &&
+			len(sig.ResultSelections) == 0 && len(sig.TypeSelections) == 0 {
+			// an empty selection set isn't a valid query, e.g. a type with
+			// custom scalar fields only
+			opts.logger().Debugf("%s has no fields to select, dropping %s", def.Name, sig.Path)
+			opts.Traversal.skip(parentType+"."+name, COVERAGE_NO_SELECTIONS)
+			sigs = sigs[1:]
+		}
+
 	} else {
 		/// In this case the field returns a scalar type and has no selection set.
 	}
@@ -246,6 +643,84 @@ func createGetMethodInner(name, parentPath, parentType string, parentFieldPath [
 	return sigs, nil
 }
 
+// addTypeSelections - for interface and union results select the concrete
+// type as "type" and every concrete type's own scalars through fragments,
+// e.g. node(id:) returns the full object rather than just the Node fields.
+// Fields sharing a name but not a type across fragments can't be merged in
+// one response, the less common shapes are aliased, e.g. databaseId_String.
+func addTypeSelections(sig *GetMethod, def *ast.Definition, schema *ast.Schema, opts *RouteOptions) {
+
+	// response keys already taken at the top level, with their shape
+	reserved := make(map[string]string, len(def.Fields)+1)
+	for _, field := range def.Fields {
+		reserved[field.Name] = field.Type.String()
+	}
+
+	if _, ok := reserved["type"]; ok {
+		sig.ResultSelections = append(sig.ResultSelections, "__typename")
+	} else {
+		sig.ResultSelections = append(sig.ResultSelections, "type: __typename")
+		reserved["type"] = "String!"
+	}
+
+	possibleTypes := schema.GetPossibleTypes(def)
+	sort.Slice(possibleTypes, func(i, j int) bool {
+		return possibleTypes[i].Name < possibleTypes[j].Name
+	})
+
+	candidates := make(map[string][]*ast.FieldDefinition, len(possibleTypes))
+	shapeCounts := make(map[string]map[string]int)
+	for _, possible := range possibleTypes {
+		if IsHiddenType(possible.Name, schema) || !opts.Contract.TypeAllowed(possible.Name, schema) {
+			continue
+		}
+		for _, sel := range scalarSelections(possible, schema, opts) {
+			field := possible.Fields.ForName(sel)
+			// fields of the interface itself are already selected
+			if def.Fields.ForName(sel) != nil {
+				continue
+			}
+			candidates[possible.Name] = append(candidates[possible.Name], field)
+			if shapeCounts[sel] == nil {
+				shapeCounts[sel] = make(map[string]int)
+			}
+			shapeCounts[sel][field.Type.String()]++
+		}
+	}
+
+	// the most common shape keeps the plain name
+	preferred := make(map[string]string, len(shapeCounts))
+	for name, counts := range shapeCounts {
+		if shape, ok := reserved[name]; ok {
+			preferred[name] = shape
+			continue
+		}
+		best := ""
+		for shape, count := range counts {
+			if best == "" || count > counts[best] || (count == counts[best] && shape < best) {
+				best = shape
+			}
+		}
+		preferred[name] = best
+	}
+
+	shapeAlias := strings.NewReplacer("!", "NonNull", "[", "ListOf", "]", "")
+
+	sig.TypeSelections = make(map[string][]string, len(candidates))
+	for typeName, fields := range candidates {
+		selections := make([]string, 0, len(fields))
+		for _, field := range fields {
+			shape := field.Type.String()
+			if shape == preferred[field.Name] {
+				selections = append(selections, field.Name)
+			} else {
+				selections = append(selections, fmt.Sprintf("%s_%s: %s", field.Name, shapeAlias.Replace(shape), field.Name))
+			}
+		}
+		sig.TypeSelections[typeName] = selections
+	}
+}
+
 // Search type for inner fields
 /*
 func searchType(name, parentPath, parentType string, parentFieldPath []FieldPathDetail, schema *ast.Schema) ([]*GetMethod, error) {
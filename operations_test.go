@@ -0,0 +1,197 @@
+package gemini
+
+import (
+	"sort"
+	"testing"
+
+	gql "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/validator"
+	"golang.org/x/exp/maps"
+)
+
+// testDirectives - federation directives used by the test schemas.
+const testDirectives = `
+directive @inaccessible on FIELD_DEFINITION | OBJECT | INTERFACE | UNION | ARGUMENT_DEFINITION | SCALAR | ENUM | ENUM_VALUE | INPUT_OBJECT | INPUT_FIELD_DEFINITION
+directive @tag(name: String!) repeatable on FIELD_DEFINITION | OBJECT | INTERFACE | UNION | ARGUMENT_DEFINITION | SCALAR | ENUM | ENUM_VALUE | INPUT_OBJECT | INPUT_FIELD_DEFINITION
+`
+
+func loadTestSchema(t *testing.T, sdl string) *ast.Schema {
+	t.Helper()
+	schema, err := gql.LoadSchema(&ast.Source{Name: "test.graphqls", Input: testDirectives + sdl})
+	if err != nil {
+		t.Fatalf("cannot load schema: %s", err)
+	}
+	return schema
+}
+
+func TestFlattenInput(t *testing.T) {
+	schema := loadTestSchema(t, `
+type Query {
+  books(filter: BookFilter): [Book]
+}
+type Book {
+  title: String
+}
+input BookFilter {
+  title: String
+  year: Int!
+  secret: String @inaccessible
+  internal: String @tag(name: "internal")
+  nested: BookFilter
+}
+`)
+	arg := schema.Query.Fields.ForName("books").Arguments.ForName("filter")
+
+	tests := []struct {
+		name     string
+		contract string
+		want     []string
+	}{
+		{"no contract", "", []string{"filter.internal", "filter.title", "filter.year"}},
+		{"excluded tag", "!internal", []string{"filter.title", "filter.year"}},
+		{"included tags only filter output fields", "public", []string{"filter.internal", "filter.title", "filter.year"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &RouteOptions{}
+			if tt.contract != "" {
+				contract, err := ParseContract(tt.contract)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts.Contract = contract
+			}
+			flat := FlattenInput("filter", arg, schema, opts)
+			got := maps.Keys(flat)
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+			if !flat["filter.year"].Required {
+				t.Errorf("filter.year should be required")
+			}
+		})
+	}
+}
+
+// checkRouteDocuments - build every route's document with all includes and
+// the required variables set, and check the schema accepts it.
+func checkRouteDocuments(t *testing.T, schema *ast.Schema, routeMap map[string]*GetMethod) {
+	t.Helper()
+	value := func(sig TypeSignature) interface{} {
+		var v interface{} = "1"
+		switch sig.Type {
+		case "Int":
+			v = int64(1)
+		case "Float":
+			v = 1.5
+		case "Boolean":
+			v = true
+		}
+		if sig.List {
+			return []interface{}{v}
+		}
+		return v
+	}
+	required := func(variables map[string]interface{}, args []PrefixedArg) {
+		for _, arg := range args {
+			if arg.Sig.Required && arg.Sig.Default == nil {
+				variables[arg.Variable] = value(arg.Sig)
+			}
+		}
+	}
+
+	for path, route := range routeMap {
+		variables := make(map[string]interface{})
+		for _, param := range route.PathParams {
+			variables[param] = value(route.PathParamTypes[param])
+		}
+		for _, item := range route.FieldPath {
+			required(variables, item.Args)
+		}
+		for name, sig := range route.QueryString {
+			if sig.Required && sig.Default == nil {
+				variables[name] = value(sig)
+			}
+		}
+		includes := maps.Keys(route.Includes)
+		sort.Strings(includes)
+		for _, name := range includes {
+			required(variables, route.Includes[name].Args)
+		}
+
+		document, opName := BuildQuery(route, &variables, includes)
+		query, gqlErrs := gql.LoadQuery(schema, document)
+		if gqlErrs != nil {
+			t.Errorf("%s: invalid document: %s\n%s", path, gqlErrs, document)
+			continue
+		}
+		if _, gqlErr := validator.VariableValues(schema, query.Operations.ForName(opName), variables); gqlErr != nil {
+			t.Errorf("%s: invalid variables: %s\n%s", path, gqlErr, document)
+		}
+	}
+}
+
+func TestRouteDocuments(t *testing.T) {
+	schema := loadTestSchema(t, `
+scalar DateTime
+enum Role { ADMIN MEMBER }
+interface Node { id: ID! }
+type Query {
+  user(id: ID!): User
+  users(first: Int = 10): [User]
+  node(id: ID!): Node
+  viewer: User
+}
+type User implements Node {
+  id: ID!
+  name: String
+  role: Role
+  joined: DateTime
+  friends(first: Int!): [User]
+  manager: User
+  organization(login: String!): Organization
+  activity: Activity
+  roles(active: Boolean): [Role]
+}
+type Organization implements Node {
+  id: ID!
+  members(first: Int): [User]
+  owner: User
+}
+type Activity {
+  first: DateTime
+  last: DateTime
+}
+`)
+	routeMap, err := CreateRouteMap(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRouteDocuments(t, schema, routeMap)
+
+	// re-entering User stops descending but still selects its fields
+	friends := routeMap["/users/:user_id/friends"]
+	if friends == nil || len(friends.ResultSelections) == 0 {
+		t.Fatalf("expected /users/:user_id/friends with selections, got %v", friends)
+	}
+	if friends.Includes["organization"] == nil {
+		t.Errorf("expected organization to be includable on /users/:user_id/friends")
+	}
+	if routeMap["/users/:user_id/friends/friends"] != nil {
+		t.Errorf("expected no route below the re-entered type")
+	}
+	// Activity has custom scalars only, there is nothing to select
+	for path, route := range routeMap {
+		if route.OriginalField == "activity" {
+			t.Errorf("expected no route for activity, got %s", path)
+		}
+	}
+}
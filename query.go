@@ -1,13 +1,16 @@
-package main
+package gemini
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"golang.org/x/exp/maps"
 )
 
 // recurse through type tree to get all layers of nested op
 // returns rendered result, max depth.
-func buildLayersRecurse(builder *strings.Builder, parentFieldPath []FieldPathDetail, depth int) int {
+func buildLayersRecurse(builder *strings.Builder, parentFieldPath []FieldPathDetail, depth int, variables map[string]interface{}) int {
 
 	if len(parentFieldPath) == 0 {
 		return depth
@@ -16,23 +19,209 @@ func buildLayersRecurse(builder *strings.Builder, parentFieldPath []FieldPathDet
 	if len(parentFieldPath) > 0 {
 		builder.WriteString(strings.Repeat(" ", depth*4))
 		builder.WriteString(parentFieldPath[0].Path)
+		args := make([]string, 0, len(parentFieldPath[0].Args)+1)
 		if parentFieldPath[0].IDInPath {
-			builder.WriteString("(id: $")
-			builder.WriteString(parentFieldPath[0].Path)
-			builder.WriteString("ID)")
+			key := parentFieldPath[0].Key
+			args = append(args, fmt.Sprintf("%s: $%s", key.Arg, key.Param))
+		}
+		for _, arg := range usedPrefixedArgs(parentFieldPath[0].Args, variables) {
+			args = append(args, fmt.Sprintf("%s: $%s", arg.Arg, arg.Variable))
+		}
+		if len(args) > 0 {
+			builder.WriteString(fmt.Sprintf("(%s)", strings.Join(args, ", ")))
 		}
 		builder.WriteString(" {\n")
+		if parentFieldPath[0].ListMode.Kind == LIST_KEY {
+			// needed to pick the element named in the path
+			builder.WriteString(strings.Repeat(" ", (depth+1)*4))
+			builder.WriteString(parentFieldPath[0].ListMode.Key)
+			builder.WriteString("\n")
+		}
 	}
 
 	if len(parentFieldPath) > 1 {
-		return buildLayersRecurse(builder, parentFieldPath[1:], depth+1)
+		return buildLayersRecurse(builder, parentFieldPath[1:], depth+1, variables)
 	}
 
 	return depth + 1
 }
 
-// BuildQuery - dynamically create GQL query, return (query document, query name)
-func BuildQuery(method *GetMethod, variables *map[string]interface{}) (string, string) {
+// usedPrefixedArgs - ancestor or include arguments to pass, the ones given
+// in the request and the required ones. Others are left out so their
+// defaults apply.
+func usedPrefixedArgs(args []PrefixedArg, variables map[string]interface{}) []PrefixedArg {
+	if variables == nil {
+		return nil
+	}
+	used := make([]PrefixedArg, 0, len(args))
+	for _, arg := range args {
+		if _, ok := variables[arg.Variable]; ok || (arg.Sig.Required && arg.Sig.Default == nil) {
+			used = append(used, arg)
+		}
+	}
+	return used
+}
+
+// usedQueryString - query string arguments to pass, sorted, the ones given
+// in the request and the required ones. Others are left out so their
+// defaults apply, e.g. avatarUrl(size: Int! = 40) without ?size. Required
+// fields of an optional input object are only passed with the object.
+func usedQueryString(method *GetMethod, variables map[string]interface{}) []string {
+	given := make(map[string]bool)
+	for _, name := range method.RequiredInputs {
+		given[name] = true
+	}
+	for k := range method.QueryString {
+		if arg, _, flattened := strings.Cut(k, "."); flattened {
+			if _, ok := variables[k]; ok {
+				given[arg] = true
+			}
+		}
+	}
+	used := make([]string, 0, len(method.QueryString))
+	for k, v := range method.QueryString {
+		required := v.Required && v.Default == nil
+		if arg, _, flattened := strings.Cut(k, "."); flattened && !given[arg] {
+			required = false
+		}
+		if _, ok := variables[k]; ok || required {
+			used = append(used, k)
+		}
+	}
+	sort.Strings(used)
+	return used
+}
+
+// queryStringVariable - GraphQL variable for a query string parameter, the
+// fields of flattened input objects are joined with __, e.g. filter__title.
+func queryStringVariable(param string) string {
+	return strings.ReplaceAll(param, ".", "__")
+}
+
+// queryStringArguments - field arguments for the query string parameters
+// used, flattened input object fields are put back together, e.g.
+// filter: {title: $filter__title}. Required input objects are always passed.
+func queryStringArguments(method *GetMethod, queryString []string) []string {
+	args := make([]string, 0, len(queryString))
+	objects := make(map[string][]string)
+	for _, name := range method.RequiredInputs {
+		objects[name] = make([]string, 0)
+	}
+	for _, k := range queryString {
+		arg, field, flattened := strings.Cut(k, ".")
+		if !flattened {
+			args = append(args, fmt.Sprintf("%s: $%s", k, k))
+			continue
+		}
+		objects[arg] = append(objects[arg], fmt.Sprintf("%s: $%s", field, queryStringVariable(k)))
+	}
+	names := maps.Keys(objects)
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("%s: {%s}", name, strings.Join(objects[name], ", ")))
+	}
+	return args
+}
+
+// writeTypeSelections - render per type selections as inline fragments.
+func writeTypeSelections(builder *strings.Builder, typeSelections map[string][]string, depth int) {
+	typeNames := maps.Keys(typeSelections)
+	sort.Strings(typeNames)
+
+	for _, typeName := range typeNames {
+		builder.WriteString(strings.Repeat("    ", depth))
+		builder.WriteString(fmt.Sprintf("... on %s {\n", typeName))
+		for _, sel := range typeSelections[typeName] {
+			builder.WriteString(strings.Repeat("    ", depth+1))
+			builder.WriteString(sel)
+			builder.WriteString("\n")
+		}
+		builder.WriteString(strings.Repeat("    ", depth))
+		builder.WriteString("}\n")
+	}
+}
+
+// buildEntityQuery - query for an entity route, through the matching root
+// field or _entities. For _entities the key variables are replaced by the
+// representations variable.
+func buildEntityQuery(method *GetMethod, variables *map[string]interface{}) (string, string) {
+
+	lookup := method.Entity
+	builder := strings.Builder{}
+
+	inner := "        "
+	if lookup.RootField != "" {
+		opName := strings.Title(lookup.RootField)
+
+		inputs := make([]string, 0, len(lookup.KeyFields))
+		args := make([]string, 0, len(lookup.KeyFields))
+		for _, keyField := range lookup.KeyFields {
+			inputs = append(inputs, fmt.Sprintf("$%s: %s!", keyField.Param, keyField.Type))
+			args = append(args, fmt.Sprintf("%s: $%s", keyField.Path[0], keyField.Param))
+			if variables != nil {
+				value := fmt.Sprintf("%v", (*variables)[keyField.Param])
+				(*variables)[keyField.Param] = coerceKeyValue(value, keyField.Type)
+			}
+		}
+		builder.WriteString(fmt.Sprintf("query %s(%s) {\n", opName, strings.Join(inputs, ", ")))
+		builder.WriteString(fmt.Sprintf("    %s(%s) {\n", lookup.RootField, strings.Join(args, ", ")))
+		for _, sel := range method.ResultSelections {
+			builder.WriteString(inner)
+			builder.WriteString(sel)
+			builder.WriteString("\n")
+		}
+		builder.WriteString("    }\n}\n")
+		return builder.String(), opName
+	}
+
+	opName := lookup.TypeName + "Entity"
+	if variables != nil {
+		representation := EntityRepresentation(lookup, *variables)
+		for _, keyField := range lookup.KeyFields {
+			delete(*variables, keyField.Param)
+		}
+		(*variables)["representations"] = []interface{}{representation}
+	}
+
+	builder.WriteString(fmt.Sprintf("query %s($representations: [_Any!]!) {\n", opName))
+	builder.WriteString("    _entities(representations: $representations) {\n")
+	builder.WriteString(fmt.Sprintf("        ... on %s {\n", lookup.TypeName))
+	for _, sel := range method.ResultSelections {
+		builder.WriteString(inner + "    ")
+		builder.WriteString(sel)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("        }\n    }\n}\n")
+	return builder.String(), opName
+}
+
+// writeIncludes - render the included fields with their arguments.
+func writeIncludes(builder *strings.Builder, method *GetMethod, includes []string, variables map[string]interface{}, depth int) {
+	for _, name := range includes {
+		include := method.Includes[name]
+		builder.WriteString(strings.Repeat("    ", depth))
+		builder.WriteString(include.Field)
+		args := make([]string, 0, len(include.Args))
+		for _, arg := range usedPrefixedArgs(include.Args, variables) {
+			args = append(args, fmt.Sprintf("%s: $%s", arg.Arg, arg.Variable))
+		}
+		if len(args) > 0 {
+			builder.WriteString(fmt.Sprintf("(%s)", strings.Join(args, ", ")))
+		}
+		if len(include.Selections) > 0 {
+			builder.WriteString(fmt.Sprintf(" { %s }", strings.Join(include.Selections, " ")))
+		}
+		builder.WriteString("\n")
+	}
+}
+
+// BuildQuery - dynamically create GQL query, return (query document, query name).
+// Includes name fields from method.Includes to add to the selection.
+func BuildQuery(method *GetMethod, variables *map[string]interface{}, includes []string) (string, string) {
+
+	if method.Entity != nil {
+		return buildEntityQuery(method, variables)
+	}
 
 	// TODO - update this for nested operations
 	builder := strings.Builder{}
@@ -40,31 +229,61 @@ func BuildQuery(method *GetMethod, variables *map[string]interface{}) (string, s
 	opName := strings.Title(method.OriginalField)
 
 	nestDepth := 0
-	// Build op name
-	if (variables != nil) && (len(*variables) > 0) {
-		builder.WriteString(fmt.Sprintf("query %s(", opName))
+	// Build op name, required arguments are declared even when no variables
+	// are given, e.g. an include's
+	if variables != nil {
+		builder.WriteString(fmt.Sprintf("query %s", opName))
 
-		inputs := make([]string, 0, len(method.QueryString))
-		for k, v := range method.QueryString {
-			inputs = append(inputs, fmt.Sprintf("$%s: %s", k, v.Type))
+		inputs := make([]string, 0, len(method.QueryString)+1)
+		for _, item := range method.FieldPath {
+			if item.IDInPath {
+				inputs = append(inputs, fmt.Sprintf("$%s: %s", item.Key.Param, item.Key.Type))
+			}
+			for _, arg := range usedPrefixedArgs(item.Args, *variables) {
+				inputs = append(inputs, fmt.Sprintf("$%s: %s", arg.Variable, arg.Sig.GQLType))
+			}
+		}
+		if method.IDInPath {
+			inputs = append(inputs, fmt.Sprintf("$%s: %s", method.Key.Param, method.Key.Type))
+		}
+		for _, name := range includes {
+			for _, arg := range usedPrefixedArgs(method.Includes[name].Args, *variables) {
+				inputs = append(inputs, fmt.Sprintf("$%s: %s", arg.Variable, arg.Sig.GQLType))
+			}
+		}
+		queryString := usedQueryString(method, *variables)
+		for _, k := range queryString {
+			variable := queryStringVariable(k)
+			if value, ok := (*variables)[k]; ok && variable != k {
+				delete(*variables, k)
+				(*variables)[variable] = value
+			}
+			if v := method.QueryString[k]; v.GQLType != "" {
+				inputs = append(inputs, fmt.Sprintf("$%s: %s", variable, v.GQLType))
+			} else {
+				inputs = append(inputs, fmt.Sprintf("$%s: %s", variable, v.Type))
+			}
+		}
+		if len(inputs) > 0 {
+			builder.WriteString(fmt.Sprintf("(%s)", strings.Join(inputs, ", ")))
 		}
-		builder.WriteString(strings.Join(inputs, ", "))
 		inputs = inputs[:0] // clear slice
 
-		builder.WriteString(") {\n")
-		nestDepth = buildLayersRecurse(&builder, method.FieldPath, 1)
+		builder.WriteString(" {\n")
+		nestDepth = buildLayersRecurse(&builder, method.FieldPath, 1, *variables)
 		builder.WriteString(strings.Repeat("    ", nestDepth+1))
 		builder.WriteString(method.OriginalField)
-		builder.WriteString("(")
 
-		for k := range method.QueryString {
-			inputs = append(inputs, fmt.Sprintf("%s: $%s", k, k))
+		if method.IDInPath {
+			inputs = append(inputs, fmt.Sprintf("%s: $%s", method.Key.Arg, method.Key.Param))
+		}
+		inputs = append(inputs, queryStringArguments(method, queryString)...)
+		if len(inputs) > 0 {
+			builder.WriteString(fmt.Sprintf("(%s)", strings.Join(inputs, ", ")))
 		}
-		builder.WriteString(strings.Join(inputs, ", "))
-		builder.WriteString(")")
 	} else {
 		builder.WriteString(fmt.Sprintf("query %s {\n", opName))
-		nestDepth = buildLayersRecurse(&builder, method.FieldPath, 1)
+		nestDepth = buildLayersRecurse(&builder, method.FieldPath, 1, nil)
 		builder.WriteString(strings.Repeat("    ", nestDepth+1))
 		builder.WriteString(method.OriginalField)
 
@@ -72,7 +291,7 @@ func BuildQuery(method *GetMethod, variables *map[string]interface{}) (string, s
 
 	// render entire selection set
 	// TODO - add include/exclude
-	if len(method.ResultSelections) > 0 {
+	if len(method.ResultSelections) > 0 || len(includes) > 0 {
 
 		builder.WriteString(" {\n")
 		for _, sel := range method.ResultSelections {
@@ -80,6 +299,12 @@ func BuildQuery(method *GetMethod, variables *map[string]interface{}) (string, s
 			builder.WriteString(sel)
 			builder.WriteString("\n")
 		}
+		writeTypeSelections(&builder, method.TypeSelections, nestDepth+2)
+		var includeVariables map[string]interface{}
+		if variables != nil {
+			includeVariables = *variables
+		}
+		writeIncludes(&builder, method, includes, includeVariables, nestDepth+2)
 		builder.WriteString(strings.Repeat("    ", nestDepth+1))
 		builder.WriteString("}\n")
 	} else {
@@ -0,0 +1,118 @@
+package gemini
+
+import (
+	"testing"
+
+	gql "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+func TestBuildQueryVariables(t *testing.T) {
+	schema := loadTestSchema(t, `
+type Query {
+  user(id: ID!): User
+  users(first: Int! = 10, after: String): [User]
+  search(term: String!): [User]
+  members(filter: MemberFilter, page: Page!): [User]
+}
+input MemberFilter {
+  name: String
+  joined: Int!
+}
+input Page {
+  first: Int
+  after: String
+}
+type User {
+  id: ID!
+  name: String
+  avatarUrl(size: Int! = 40): String
+}
+`)
+	routeMap, err := CreateRouteMap(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		variables map[string]interface{}
+		declared  []string
+	}{
+		{"non-null default left out", "/users/:user_id/avatar_url", map[string]interface{}{"user_id": "1"}, []string{"$user_id: ID!"}},
+		{"non-null default given", "/users/:user_id/avatar_url", map[string]interface{}{"user_id": "1", "size": int64(80)}, []string{"$user_id: ID!", "$size: Int!"}},
+		{"only optional args given", "/users", map[string]interface{}{"after": "abc"}, []string{"$after: String"}},
+		{"unknown param only", "/users", map[string]interface{}{"unknown": "x"}, nil},
+		{"required arg", "/search", map[string]interface{}{"term": "ann"}, []string{"$term: String!"}},
+		// page: {} is passed, the required joined doesn't pull in the optional filter
+		{"required input object without fields", "/members", map[string]interface{}{}, nil},
+		{"input object fields", "/members", map[string]interface{}{"filter.joined": int64(2020), "page.first": int64(5)}, []string{"$filter__joined: Int!", "$page__first: Int"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := routeMap[tt.path]
+			if route == nil {
+				t.Fatalf("no route %s in %v", tt.path, routeMap)
+			}
+			document, opName := BuildQuery(route, &tt.variables, nil)
+			query, gqlErrs := gql.LoadQuery(schema, document)
+			if gqlErrs != nil {
+				t.Fatalf("invalid document: %s\n%s", gqlErrs, document)
+			}
+			op := query.Operations.ForName(opName)
+			if op == nil {
+				t.Fatalf("no operation %s in\n%s", opName, document)
+			}
+			if _, gqlErr := validator.VariableValues(schema, op, tt.variables); gqlErr != nil {
+				t.Fatalf("invalid variables: %s\n%s", gqlErr, document)
+			}
+			if len(op.VariableDefinitions) != len(tt.declared) {
+				t.Fatalf("expected variables %v, got\n%s", tt.declared, document)
+			}
+			for i, definition := range op.VariableDefinitions {
+				if got := "$" + definition.Variable + ": " + definition.Type.String(); got != tt.declared[i] {
+					t.Errorf("expected %s, got %s", tt.declared[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildQueryIncludes(t *testing.T) {
+	schema := loadTestSchema(t, `
+type Query {
+  viewer: User
+}
+type User {
+  login: String
+  organization(login: String!): Organization
+}
+type Organization {
+  name: String
+}
+`)
+	routeMap, err := CreateRouteMap(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := routeMap["/viewer"]
+	if route == nil || route.Includes["organization"] == nil {
+		t.Fatalf("expected /viewer to include organization, got %v", routeMap)
+	}
+
+	// no other variables, the include's argument is still declared
+	variables := map[string]interface{}{"include__organization__login": "acme"}
+	for _, given := range []map[string]interface{}{variables, {}} {
+		document, opName := BuildQuery(route, &given, []string{"organization"})
+		query, gqlErrs := gql.LoadQuery(schema, document)
+		if gqlErrs != nil {
+			t.Fatalf("invalid document: %s\n%s", gqlErrs, document)
+		}
+		op := query.Operations.ForName(opName)
+		if len(op.VariableDefinitions) != 1 || op.VariableDefinitions[0].Variable != "include__organization__login" {
+			t.Errorf("expected $include__organization__login to be declared in\n%s", document)
+		}
+	}
+}
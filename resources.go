@@ -0,0 +1,139 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Inflector - singular/plural rules for resource names. Irregular plurals
+// override the default English rules, e.g. person -> people.
+type Inflector struct {
+	Irregular map[string]string // singular -> plural, snake_case
+}
+
+// ParseInflector - parse "singular:plural" pairs separated by commas,
+// e.g. "person:people,child:children".
+func ParseInflector(spec string) (*Inflector, error) {
+	inflector := &Inflector{Irregular: make(map[string]string)}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("plural rule must be in the form singular:plural, got %s", pair)
+		}
+		inflector.Irregular[ToSnakeCase(parts[0])] = ToSnakeCase(parts[1])
+	}
+	return inflector, nil
+}
+
+// Plural - plural of a snake_case name.
+func (i *Inflector) Plural(singular string) string {
+	if i != nil {
+		if plural, ok := i.Irregular[singular]; ok {
+			return plural
+		}
+	}
+	return Pluralize(singular)
+}
+
+// ResourceGroup - a collection root field and the item root field merged
+// into one REST resource, e.g. authors + author(id:) -> /authors, /authors/:id.
+type ResourceGroup struct {
+	Collection string
+	Item       string
+	Path       string
+}
+
+// GroupResources - find root fields that should share a resource path. An
+// item field is merged into a collection when it returns the collection's
+// element type, looks up by a path key and its plural is the collection's name.
+// Ambiguous or conflicting candidates are reported and left alone.
+func GroupResources(schema *ast.Schema, opts *RouteOptions) map[string]*ResourceGroup {
+	groups := make(map[string]*ResourceGroup)
+	if schema.Query == nil {
+		return groups
+	}
+
+	candidates := make(map[string][]*ast.FieldDefinition)
+	for _, item := range schema.Query.Fields {
+		if item.Type.Elem != nil || PathKeyArgument(item, opts) == nil || IsHiddenField(item, schema) {
+			continue
+		}
+		if !opts.Contract.FieldAllowed(schema.Query.Name, item, schema) {
+			continue
+		}
+		plural := opts.Inflector.Plural(ToSnakeCase(item.Name))
+		for _, collection := range schema.Query.Fields {
+			if collection.Type.Elem == nil || collection.Type.Name() != item.Type.Name() {
+				continue
+			}
+			if ToSnakeCase(collection.Name) == plural {
+				candidates[collection.Name] = append(candidates[collection.Name], item)
+			}
+		}
+	}
+
+	collections := make([]string, 0, len(candidates))
+	for name := range candidates {
+		collections = append(collections, name)
+	}
+	sort.Strings(collections)
+
+	for _, name := range collections {
+		items := candidates[name]
+		collection := schema.Query.Fields.ForName(name)
+		if len(items) > 1 {
+			names := make([]string, 0, len(items))
+			for _, item := range items {
+				names = append(names, item.Name)
+			}
+			opts.logger().Warnf("Resource conflict: %s has several item fields (%s), not merging", name, strings.Join(names, ", "))
+			continue
+		}
+		if PathKeyArgument(collection, opts) != nil {
+			opts.logger().Warnf("Resource conflict: %s and %s both take a path key, not merging", name, items[0].Name)
+			continue
+		}
+		if IsHiddenField(collection, schema) || !opts.Contract.FieldAllowed(schema.Query.Name, collection, schema) {
+			continue
+		}
+		groups[items[0].Name] = &ResourceGroup{
+			Collection: name,
+			Item:       items[0].Name,
+			Path:       "/" + ToSnakeCase(name),
+		}
+		opts.logger().Infof("Resource %s: merged %s and %s", groups[items[0].Name].Path, name, items[0].Name)
+	}
+	return groups
+}
+
+// addNodeRoute - Relay clients look objects up at /node/:node_id, keep
+// serving it when node(id:) was merged into /nodes.
+func addNodeRoute(routeMap map[string]*GetMethod, groups map[string]*ResourceGroup, opts *RouteOptions) {
+	group := groups["node"]
+	if group == nil {
+		return
+	}
+	for _, method := range routeMap {
+		if method.OriginalField != group.Item || len(method.FieldPath) > 0 || !method.IDInPath || method.Entity != nil {
+			continue
+		}
+		path := "/node/:" + method.Key.Param
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		if blocker, _ := routeTrie(routeMap).find(segments); blocker != nil {
+			opts.logger().Warnf("Cannot serve %s, it collides with %s", path, blocker.Path)
+			return
+		}
+		alias := *method
+		alias.Path = path
+		routeMap[path] = &alias
+		opts.logger().Infof("GET %s - same as %s", path, method.Path)
+		return
+	}
+}
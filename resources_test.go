@@ -0,0 +1,82 @@
+package gemini
+
+import (
+	"testing"
+)
+
+func TestResourceRoutes(t *testing.T) {
+	schema := loadTestSchema(t, `
+interface Node {
+  id: ID!
+}
+type Author implements Node {
+  id: ID!
+  name: String
+}
+type Person implements Node {
+  id: ID!
+  name: String
+}
+type Query {
+  node(id: ID!): Node
+  nodes(ids: [ID!]!): [Node]!
+  author(id: ID!): Author
+  authors: [Author]
+  person(id: ID!): Person
+  people: [Person]
+}
+`)
+
+	tests := []struct {
+		name      string
+		opts      *RouteOptions
+		routes    []string
+		notRoutes []string
+	}{
+		{
+			name:      "merged",
+			opts:      &RouteOptions{},
+			routes:    []string{"/authors", "/authors/:author_id", "/nodes", "/nodes/:node_id", "/node/:node_id"},
+			notRoutes: []string{"/author/:author_id", "/people/:person_id"},
+		},
+		{
+			name:   "irregular plural",
+			opts:   &RouteOptions{Inflector: &Inflector{Irregular: map[string]string{"person": "people"}}},
+			routes: []string{"/people", "/people/:person_id"},
+		},
+		{
+			name:      "separate resources",
+			opts:      &RouteOptions{SeparateResources: true},
+			routes:    []string{"/authors", "/author/:author_id", "/nodes", "/node/:node_id"},
+			notRoutes: []string{"/authors/:author_id", "/nodes/:node_id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeMap, err := CreateRouteMap(schema, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range tt.routes {
+				if routeMap[path] == nil {
+					t.Errorf("missing route %s", path)
+				}
+			}
+			for _, path := range tt.notRoutes {
+				if routeMap[path] != nil {
+					t.Errorf("unexpected route %s", path)
+				}
+			}
+		})
+	}
+
+	routeMap, _ := CreateRouteMap(schema, nil)
+	node, merged := routeMap["/node/:node_id"], routeMap["/nodes/:node_id"]
+	if node.OriginalField != "node" || node.Deprecation != nil || len(node.TypeSelections) != 2 {
+		t.Errorf("/node/:node_id should serve node(id:) with per type selections, got %+v", node)
+	}
+	if merged.Path != "/nodes/:node_id" {
+		t.Errorf("merged route changed path to %s", merged.Path)
+	}
+}
@@ -1,36 +1,100 @@
-package main
+package gemini
 
 import (
 	"strings"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
+// RouteOptions - knobs for route generation, nil means defaults.
+type RouteOptions struct {
+	Contract          *Contract           // only publish fields allowed by this @tag contract
+	Inflector         *Inflector          // singular/plural rules for resource names
+	SeparateResources bool                // don't merge item fields into their collection's path
+	PathKeys          map[string]bool     // extra arguments encoded into the path, "arg" or "field.arg"
+	ListModes         map[string]ListMode // how routes go through list fields, by the list field's route
+	Traversal         *Traversal          // depth limits, collects cut off paths
+	Collisions        string              // COLLISION_* strategy, prefer-root when empty
+	StrictRoutes      bool                // fail instead of resolving collisions
+	Renames           map[string]string   // path segment for a field, "Type.field" -> segment
+	Diagnostics       *Diagnostics        // collects lint findings, nil discards them
+	Deprecations      *DeprecationOptions // sunset dates and docs for deprecated routes
+	Aliases           map[string]string   // old path of a renamed route -> its current path
+	Logger            logrus.FieldLogger  // nil logs to the logrus standard logger
+
+	resourcePaths map[string]string // root field -> path of the resource it was merged into
+}
+
 // CreateRouteMap - build query details for all operations reachable
 // by REST routes.
-func CreateRouteMap(ast *ast.Schema) (map[string]*GetMethod, error) {
+func CreateRouteMap(ast *ast.Schema, opts *RouteOptions) (map[string]*GetMethod, error) {
 
-	routeMap := make(map[string]*GetMethod, 10)
+	if opts == nil {
+		opts = &RouteOptions{}
+	}
+
+	groups := map[string]*ResourceGroup{}
+	if !opts.SeparateResources {
+		groups = GroupResources(ast, opts)
+	}
 
+	// serve merged items under their collection, /author/:id -> /authors/:id
+	local := *opts
+	local.resourcePaths = make(map[string]string, len(groups))
+	for item, group := range groups {
+		local.resourcePaths[item] = group.Path
+	}
+	opts = &local
+
+	sigs := make([]*GetMethod, 0, 10)
 	for _, thing := range ast.Query.Fields {
-		if strings.HasPrefix(thing.Name, "__") {
+		if strings.HasPrefix(thing.Name, "__") || IsHiddenField(thing, ast) {
 			continue
 		}
-		sigs, _ := CreateGetMethod(thing.Name, "", "Query", nil, ast)
-
-		for _, sig := range sigs {
-			log.Infof("GET %s - %#v", sig.Path, sig.FieldPath)
-
-			for k, v := range sig.QueryString {
-				log.Infof("  %s=%s", k, v.Type)
-			}
+		if !opts.Contract.FieldAllowed(ast.Query.Name, thing, ast) {
+			opts.logger().Debugf("Query.%s excluded by contract", thing.Name)
+			continue
+		}
+		fieldSigs, err := CreateGetMethod(thing.Name, "", "Query", nil, ast, opts)
+		if err != nil {
+			opts.logger().Warnf("Cannot create routes for Query.%s: %s", thing.Name, err)
+			opts.Diagnostics.Add(LINT_ROUTE_ERROR, "Query."+thing.Name, err.Error(), thing.Position)
+		}
+		sigs = append(sigs, fieldSigs...)
+	}
+	sigs = append(sigs, CreateEntityMethods(ast, opts)...)
 
-			routeMap[sig.Path] = sig
+	routeMap, collisions := ResolveCollisions(sigs, opts.Collisions)
+	for _, collision := range collisions {
+		opts.logger().Warnf("Route collision: %s", collision)
+		opts.Diagnostics.Add(LINT_ROUTE_COLLISION, collision.Field, collision.String(), coordinatePosition(ast, collision.Field))
+	}
+	addNodeRoute(routeMap, groups, opts)
+	applyRouteAliases(routeMap, opts)
 
+	for _, sig := range sigs {
+		if routeMap[sig.Path] != sig {
+			continue
+		}
+		if sig.Entity != nil {
+			opts.logger().Infof("GET %s - entity %s by key \"%s\" via %s", sig.Path, sig.Entity.TypeName, sig.Entity.Key, sig.OriginalField)
+			continue
+		}
+		opts.logger().Infof("GET %s - %#v", sig.Path, sig.FieldPath)
+		if len(sig.Subgraphs) > 0 {
+			opts.logger().Infof("  served by subgraph %s", strings.Join(sig.Subgraphs, ", "))
 		}
 
+		for k, v := range sig.QueryString {
+			opts.logger().Infof("  %s=%s", k, v.Type)
+		}
 	}
 
+	opts.Traversal.Report(opts.logger())
+
+	if opts.StrictRoutes && len(collisions) > 0 {
+		return routeMap, &RouteCollisionError{Collisions: collisions}
+	}
 	return routeMap, nil
 }
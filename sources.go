@@ -0,0 +1,278 @@
+package gemini
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	gql "github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// SchemaSource - somewhere a schema can be loaded from. A source may return
+// several documents, they are merged when the schema is loaded so type
+// extensions in one document apply to types in another.
+type SchemaSource interface {
+	Name() string
+	Load() ([]*ast.Source, error)
+}
+
+// LoadSchema - load and parse a schema from a source.
+func LoadSchema(source SchemaSource) (*ast.Schema, error) {
+	sources, err := source.Load()
+	if err != nil {
+		return nil, err
+	}
+	schema, gqlErr := gql.LoadSchema(sources...)
+	if gqlErr != nil {
+		return nil, &SchemaParseError{Err: gqlErr}
+	}
+	return schema, nil
+}
+
+// SchemaParseError - the sources loaded but aren't a valid schema.
+type SchemaParseError struct {
+	Err error
+}
+
+func (e *SchemaParseError) Error() string {
+	return fmt.Sprintf("invalid schema: %s", e.Err)
+}
+
+// NewLocalSchemaSource - pick a source for the -schema flag, which may be a
+// single file, a directory, a glob or an HTTP(S) URL.
+func NewLocalSchemaSource(location, cacheDir string, logger logrus.FieldLogger) SchemaSource {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return &URLSource{URL: location, CacheDir: cacheDir, Logger: logger}
+	}
+	if strings.ContainsAny(location, "*?[") {
+		return &GlobSource{Pattern: location, Logger: logger}
+	}
+	if info, err := os.Stat(location); err == nil && info.IsDir() {
+		return &GlobSource{Dir: location, Logger: logger}
+	}
+	return &FileSource{Path: location}
+}
+
+// StudioSource - supergraph fetched from Apollo Studio.
+type StudioSource struct {
+	GraphID string
+	Variant string
+	APIKey  string
+	Pin     SupergraphPin
+	Logger  logrus.FieldLogger // nil logs to the logrus standard logger
+}
+
+func (s *StudioSource) Name() string {
+	return fmt.Sprintf("%s@%s", s.GraphID, s.Variant)
+}
+
+func (s *StudioSource) Load() ([]*ast.Source, error) {
+	supergraphResult, err := downloadSupergraph(s.GraphID, s.Variant, s.APIKey, s.Pin, orStandardLogger(s.Logger))
+	if err != nil {
+		return nil, err
+	}
+	composition := supergraphResult.Composition()
+	orStandardLogger(s.Logger).Infof("Using composition %s", composition.GraphCompositionID)
+
+	return []*ast.Source{{Name: s.Name(), Input: composition.SupergraphSDL}}, nil
+}
+
+// FileSource - a single schema file on disk.
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Name() string {
+	return s.Path
+}
+
+func (s *FileSource) Load() ([]*ast.Source, error) {
+	fileContents, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schema file: %s", err)
+	}
+	return []*ast.Source{{Name: s.Path, Input: string(fileContents)}}, nil
+}
+
+// GlobSource - every .graphqls/.graphql file under a directory, or every file
+// matching a glob pattern.
+type GlobSource struct {
+	Dir     string
+	Pattern string
+	Logger  logrus.FieldLogger // nil logs to the logrus standard logger
+}
+
+func (s *GlobSource) Name() string {
+	if s.Pattern != "" {
+		return s.Pattern
+	}
+	return s.Dir
+}
+
+func (s *GlobSource) Load() ([]*ast.Source, error) {
+	var paths []string
+	var err error
+
+	if s.Pattern != "" {
+		paths, err = filepath.Glob(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad schema glob %s: %s", s.Pattern, err)
+		}
+	} else {
+		err = filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(path)
+			if !d.IsDir() && (ext == ".graphqls" || ext == ".graphql") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read schema directory %s: %s", s.Dir, err)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no schema files found in %s", s.Name())
+	}
+
+	// keep load order stable so errors and routes are reproducible
+	sort.Strings(paths)
+
+	sources := make([]*ast.Source, 0, len(paths))
+	for _, path := range paths {
+		fileSources, err := (&FileSource{Path: path}).Load()
+		if err != nil {
+			return nil, err
+		}
+		orStandardLogger(s.Logger).Debugf("Loaded schema file %s", path)
+		sources = append(sources, fileSources...)
+	}
+	return sources, nil
+}
+
+// URLSource - SDL served over HTTP(S). The last response is cached on disk
+// with its ETag so unchanged schemas are not downloaded again, and the cached
+// copy is used if the server cannot be reached.
+type URLSource struct {
+	URL      string
+	Headers  http.Header
+	CacheDir string
+	Logger   logrus.FieldLogger // nil logs to the logrus standard logger
+}
+
+func (s *URLSource) Name() string {
+	return s.URL
+}
+
+func (s *URLSource) cachePaths() (string, string) {
+	sum := sha256.Sum256([]byte(s.URL))
+	base := filepath.Join(s.CacheDir, hex.EncodeToString(sum[:]))
+	return base + ".graphqls", base + ".etag"
+}
+
+func (s *URLSource) Load() ([]*ast.Source, error) {
+
+	schemaPath, etagPath := "", ""
+	cached := ""
+	etag := ""
+	if s.CacheDir != "" {
+		schemaPath, etagPath = s.cachePaths()
+		if contents, err := os.ReadFile(schemaPath); err == nil {
+			cached = string(contents)
+			if tag, err := os.ReadFile(etagPath); err == nil {
+				etag = string(tag)
+			}
+		}
+	}
+
+	request, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could create request %s", err)
+	}
+	for name, values := range s.Headers {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		if cached != "" {
+			orStandardLogger(s.Logger).Warnf("Cannot fetch schema from %s, using cached copy: %s", s.URL, err)
+			return []*ast.Source{{Name: s.URL, Input: cached}}, nil
+		}
+		return nil, fmt.Errorf("could not fetch schema from %s: %s", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		orStandardLogger(s.Logger).Infof("Schema at %s not modified, using cached copy", s.URL)
+		return []*ast.Source{{Name: s.URL, Input: cached}}, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("schema fetch from %s responded with HTTP %d", s.URL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema from %s: %s", s.URL, err)
+	}
+
+	if s.CacheDir != "" {
+		if err = os.MkdirAll(s.CacheDir, 0o755); err == nil {
+			err = os.WriteFile(schemaPath, body, 0o644)
+		}
+		if err == nil {
+			err = os.WriteFile(etagPath, []byte(resp.Header.Get("ETag")), 0o644)
+		}
+		if err != nil {
+			orStandardLogger(s.Logger).Warnf("Cannot cache schema from %s: %s", s.URL, err)
+		}
+	}
+
+	return []*ast.Source{{Name: s.URL, Input: string(body)}}, nil
+}
+
+// IntrospectionSource - schema introspected from a running GraphQL endpoint.
+type IntrospectionSource struct {
+	URL     string
+	Headers http.Header
+	Logger  logrus.FieldLogger // nil logs to the logrus standard logger
+}
+
+// IntrospectionError - the introspection query could not be run or decoded.
+type IntrospectionError struct {
+	Err error
+}
+
+func (e *IntrospectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (s *IntrospectionSource) Name() string {
+	return s.URL
+}
+
+func (s *IntrospectionSource) Load() ([]*ast.Source, error) {
+	sdl, err := introspectSchema(s.URL, s.Headers, orStandardLogger(s.Logger))
+	if err != nil {
+		return nil, &IntrospectionError{Err: err}
+	}
+	return []*ast.Source{{Name: s.URL, Input: sdl}}, nil
+}
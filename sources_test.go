@@ -0,0 +1,133 @@
+package gemini
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"query.graphqls":        "type Query { book(isbn: ID!): Book }",
+		"books/book.graphqls":   "type Book { isbn: ID! title: String }",
+		"books/extend.graphql":  "extend type Book { year: Int }",
+		"books/notes.txt":       "not a schema",
+		"authors/author.graphq": "not matched either",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		source SchemaSource
+		fields []string // fields of Book after merging
+		err    bool
+	}{
+		{"directory", NewLocalSchemaSource(dir, "", nil), []string{"isbn", "title", "year"}, false},
+		// Book is defined in another directory
+		{"glob", NewLocalSchemaSource(filepath.Join(dir, "*.graphqls"), "", nil), nil, true},
+		{"glob across directories", &GlobSource{Pattern: filepath.Join(dir, "*", "*.graphql*")}, []string{"isbn", "title", "year"}, false},
+		{"no files", NewLocalSchemaSource(filepath.Join(dir, "*.json"), "", nil), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := LoadSchema(tt.source)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %t, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			book := schema.Types["Book"]
+			if book == nil || len(book.Fields) != len(tt.fields) {
+				t.Fatalf("expected Book with %v, got %v", tt.fields, book)
+			}
+			for i, field := range book.Fields {
+				if field.Name != tt.fields[i] {
+					t.Errorf("expected %s, got %s", tt.fields[i], field.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestURLSourceCache(t *testing.T) {
+	sdl := "type Query { hello: String }"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(sdl))
+	}))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	source := &URLSource{URL: server.URL, Headers: http.Header{"Authorization": {"Bearer token"}}, CacheDir: cacheDir}
+
+	load := func(step string) string {
+		t.Helper()
+		sources, err := source.Load()
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+		return sources[0].Input
+	}
+
+	if got := load("first fetch"); got != sdl {
+		t.Errorf("expected the served schema, got %q", got)
+	}
+	schemaPath, etagPath := source.cachePaths()
+	if cached, _ := os.ReadFile(schemaPath); string(cached) != sdl {
+		t.Errorf("expected the schema to be cached, got %q", cached)
+	}
+	if etag, _ := os.ReadFile(etagPath); string(etag) != `"v1"` {
+		t.Errorf("expected the ETag to be cached, got %q", etag)
+	}
+
+	// the server answers 304 for the cached ETag, the cached copy is used
+	if got := load("not modified"); got != sdl {
+		t.Errorf("expected the cached schema, got %q", got)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	// the server is gone, the cached copy is used
+	server.Close()
+	if got := load("server down"); got != sdl {
+		t.Errorf("expected the cached schema, got %q", got)
+	}
+
+	// without a cached copy a failed fetch is an error
+	uncached := &URLSource{URL: server.URL, CacheDir: t.TempDir()}
+	if _, err := uncached.Load(); err == nil {
+		t.Errorf("expected an error without a cached copy")
+	}
+}
+
+func TestURLSourceStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	if _, err := (&URLSource{URL: server.URL}).Load(); err == nil {
+		t.Errorf("expected an error for a 404")
+	}
+}
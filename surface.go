@@ -0,0 +1,291 @@
+package gemini
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// RouteSpec - the published shape of a route, what REST clients depend on.
+type RouteSpec struct {
+	Method      string               `json:"method"`
+	Path        string               `json:"path"`
+	Field       string               `json:"field"`
+	PathParams  []string             `json:"pathParams,omitempty"`
+	QueryParams map[string]ParamSpec `json:"queryParams,omitempty"`
+	Selections  []string             `json:"selections,omitempty"`
+}
+
+// ParamSpec - a query string parameter of a route.
+type ParamSpec struct {
+	Type     string `json:"type"`
+	List     bool   `json:"list,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+func paramSpec(sig TypeSignature) ParamSpec {
+	return ParamSpec{
+		Type:     sig.Type,
+		List:     sig.List,
+		Required: sig.Required && sig.Default == nil,
+	}
+}
+
+// BuildSurface - specs of every route in a route map, sorted by path.
+func BuildSurface(routeMap map[string]*GetMethod) []RouteSpec {
+	paths := maps.Keys(routeMap)
+	sort.Strings(paths)
+
+	specs := make([]RouteSpec, 0, len(paths))
+	for _, path := range paths {
+		method := routeMap[path]
+		spec := RouteSpec{
+			Method:      method.Method,
+			Path:        path,
+			Field:       method.Coordinate(),
+			PathParams:  method.PathParams,
+			QueryParams: make(map[string]ParamSpec),
+			Selections:  append([]string{}, method.ResultSelections...),
+		}
+		if spec.Method == "" {
+			spec.Method = "GET"
+		}
+		for name, sig := range method.QueryString {
+			spec.QueryParams[name] = paramSpec(sig)
+		}
+		for _, item := range method.FieldPath {
+			for _, arg := range item.Args {
+				spec.QueryParams[arg.Param] = paramSpec(arg.Sig)
+			}
+		}
+		for _, include := range method.Includes {
+			for _, arg := range include.Args {
+				spec.QueryParams[arg.Param] = paramSpec(arg.Sig)
+			}
+		}
+		for typeName, sels := range method.TypeSelections {
+			for _, sel := range sels {
+				spec.Selections = append(spec.Selections, fmt.Sprintf("... on %s %s", typeName, sel))
+			}
+		}
+		sort.Strings(spec.Selections)
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// RouteChange - one difference between two route surfaces.
+type RouteChange struct {
+	Breaking bool   `json:"breaking"`
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	To       string `json:"to,omitempty"` // new path of a moved route
+	Detail   string `json:"detail"`
+}
+
+const (
+	CHANGE_ROUTE_REMOVED   = "route-removed"
+	CHANGE_ROUTE_ADDED     = "route-added"
+	CHANGE_PATH_CHANGED    = "path-changed"
+	CHANGE_PARAM_REMOVED   = "param-removed"
+	CHANGE_PARAM_RENAMED   = "param-renamed"
+	CHANGE_PARAM_ADDED     = "param-added"
+	CHANGE_PARAM_REQUIRED  = "param-required"
+	CHANGE_PARAM_OPTIONAL  = "param-optional"
+	CHANGE_PARAM_NARROWED  = "param-narrowed"
+	CHANGE_PARAM_WIDENED   = "param-widened"
+	CHANGE_FIELD_REMOVED   = "field-removed"
+	CHANGE_FIELD_ADDED     = "field-added"
+	CHANGE_ROUTE_REFIELDED = "route-field-changed"
+)
+
+// widerTypes - scalar types that accept every value of the key type.
+var widerTypes = map[string][]string{
+	"Int": {"Float", "String", "ID"},
+	"ID":  {"String"},
+}
+
+// typeChange - classify a query param type change, empty if unchanged.
+func typeChange(before, after ParamSpec) (string, bool) {
+	if before.Type == after.Type && before.List == after.List {
+		return "", false
+	}
+	if before.List && !after.List {
+		return CHANGE_PARAM_NARROWED, true
+	}
+	if before.Type == after.Type {
+		// single value to list, a single value is still a valid list
+		return CHANGE_PARAM_WIDENED, false
+	}
+	for _, wider := range widerTypes[before.Type] {
+		if wider == after.Type {
+			return CHANGE_PARAM_WIDENED, false
+		}
+	}
+	return CHANGE_PARAM_NARROWED, true
+}
+
+// DiffSurfaces - changes from before to after. Routes are matched by path,
+// then by the field they serve, so a moved route is reported as a path change.
+func DiffSurfaces(before, after []RouteSpec) []RouteChange {
+	changes := make([]RouteChange, 0)
+	add := func(breaking bool, kind, path, detail string, args ...interface{}) {
+		changes = append(changes, RouteChange{Breaking: breaking, Kind: kind, Path: path, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	beforeByPath := make(map[string]bool, len(before))
+	for i := range before {
+		beforeByPath[before[i].Path] = true
+	}
+	afterByPath := make(map[string]*RouteSpec, len(after))
+	afterByField := make(map[string][]*RouteSpec, len(after))
+	for i := range after {
+		afterByPath[after[i].Path] = &after[i]
+		afterByField[after[i].Field] = append(afterByField[after[i].Field], &after[i])
+	}
+	matched := make(map[string]bool, len(after))
+
+	for i := range before {
+		old := &before[i]
+		current, ok := afterByPath[old.Path]
+		if !ok {
+			// same field under a path that didn't exist before
+			for _, moved := range afterByField[old.Field] {
+				if !matched[moved.Path] && !beforeByPath[moved.Path] {
+					add(true, CHANGE_PATH_CHANGED, old.Path, "%s moved to %s", old.Field, moved.Path)
+					changes[len(changes)-1].To = moved.Path
+					current = moved
+					break
+				}
+			}
+		}
+		if current == nil {
+			add(true, CHANGE_ROUTE_REMOVED, old.Path, "%s no longer has a route", old.Field)
+			continue
+		}
+		matched[current.Path] = true
+		if current.Field != old.Field {
+			add(false, CHANGE_ROUTE_REFIELDED, old.Path, "served by %s instead of %s", current.Field, old.Field)
+		}
+		diffParams(old, current, add)
+		diffSelections(old, current, add)
+	}
+
+	for i := range after {
+		if !matched[after[i].Path] {
+			add(false, CHANGE_ROUTE_ADDED, after[i].Path, "new route for %s", after[i].Field)
+		}
+	}
+	return changes
+}
+
+func diffParams(old, current *RouteSpec, add func(bool, string, string, string, ...interface{})) {
+	names := maps.Keys(old.QueryParams)
+	sort.Strings(names)
+	addedNames := make([]string, 0)
+	for name := range current.QueryParams {
+		if _, ok := old.QueryParams[name]; !ok {
+			addedNames = append(addedNames, name)
+		}
+	}
+	sort.Strings(addedNames)
+	renamedTo := make(map[string]bool)
+
+	for _, name := range names {
+		before := old.QueryParams[name]
+		after, ok := current.QueryParams[name]
+		if !ok {
+			// a removed and an added param of the same type is most likely a rename
+			renamed := ""
+			for _, candidate := range addedNames {
+				if !renamedTo[candidate] && current.QueryParams[candidate].Type == before.Type {
+					renamed = candidate
+					break
+				}
+			}
+			if renamed != "" {
+				renamedTo[renamed] = true
+				add(true, CHANGE_PARAM_RENAMED, old.Path, "query param %s renamed to %s", name, renamed)
+			} else {
+				add(true, CHANGE_PARAM_REMOVED, old.Path, "query param %s removed", name)
+			}
+			continue
+		}
+		if kind, breaking := typeChange(before, after); kind != "" {
+			add(breaking, kind, old.Path, "query param %s changed from %s to %s", name, describeParam(before), describeParam(after))
+		}
+		if !before.Required && after.Required {
+			add(true, CHANGE_PARAM_REQUIRED, old.Path, "query param %s is now required", name)
+		} else if before.Required && !after.Required {
+			add(false, CHANGE_PARAM_OPTIONAL, old.Path, "query param %s is now optional", name)
+		}
+	}
+	for _, name := range addedNames {
+		if renamedTo[name] {
+			continue
+		}
+		if current.QueryParams[name].Required {
+			add(true, CHANGE_PARAM_REQUIRED, old.Path, "new required query param %s", name)
+		} else {
+			add(false, CHANGE_PARAM_ADDED, old.Path, "new query param %s", name)
+		}
+	}
+}
+
+func describeParam(param ParamSpec) string {
+	if param.List {
+		return "[" + param.Type + "]"
+	}
+	return param.Type
+}
+
+func diffSelections(old, current *RouteSpec, add func(bool, string, string, string, ...interface{})) {
+	before := make(map[string]bool, len(old.Selections))
+	for _, sel := range old.Selections {
+		before[sel] = true
+	}
+	after := make(map[string]bool, len(current.Selections))
+	for _, sel := range current.Selections {
+		after[sel] = true
+	}
+	for _, sel := range old.Selections {
+		if !after[sel] {
+			add(true, CHANGE_FIELD_REMOVED, old.Path, "response field %s removed", sel)
+		}
+	}
+	for _, sel := range current.Selections {
+		if !before[sel] {
+			add(false, CHANGE_FIELD_ADDED, old.Path, "new response field %s", sel)
+		}
+	}
+}
+
+// HasBreaking - any breaking change.
+func HasBreaking(changes []RouteChange) bool {
+	for _, change := range changes {
+		if change.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteChanges - one line per change, breaking ones first.
+func WriteChanges(w io.Writer, changes []RouteChange) {
+	sorted := append([]RouteChange{}, changes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Breaking && !sorted[j].Breaking
+	})
+	breaking := 0
+	for _, change := range sorted {
+		label := "safe"
+		if change.Breaking {
+			label = "BREAKING"
+			breaking++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", label, change.Kind, change.Path, change.Detail)
+	}
+	fmt.Fprintf(w, "\n%d changes, %d breaking\n", len(changes), breaking)
+}
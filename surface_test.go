@@ -0,0 +1,180 @@
+package gemini
+
+import (
+	"testing"
+)
+
+func TestDiffSurfaces(t *testing.T) {
+	book := RouteSpec{
+		Method:      "GET",
+		Path:        "/books/:book_isbn",
+		Field:       "Query.book",
+		PathParams:  []string{"book_isbn"},
+		QueryParams: map[string]ParamSpec{"locale": {Type: "String"}},
+		Selections:  []string{"isbn", "title"},
+	}
+	with := func(change func(spec *RouteSpec)) RouteSpec {
+		spec := book
+		spec.QueryParams = make(map[string]ParamSpec)
+		for name, param := range book.QueryParams {
+			spec.QueryParams[name] = param
+		}
+		spec.Selections = append([]string{}, book.Selections...)
+		change(&spec)
+		return spec
+	}
+
+	tests := []struct {
+		name     string
+		before   []RouteSpec
+		after    []RouteSpec
+		kinds    []string
+		breaking bool
+	}{
+		{
+			name:   "unchanged",
+			before: []RouteSpec{book},
+			after:  []RouteSpec{book},
+		},
+		{
+			name:     "route removed",
+			before:   []RouteSpec{book},
+			after:    []RouteSpec{},
+			kinds:    []string{CHANGE_ROUTE_REMOVED},
+			breaking: true,
+		},
+		{
+			name:   "route added",
+			before: []RouteSpec{},
+			after:  []RouteSpec{book},
+			kinds:  []string{CHANGE_ROUTE_ADDED},
+		},
+		{
+			name:     "moved route",
+			before:   []RouteSpec{book},
+			after:    []RouteSpec{with(func(spec *RouteSpec) { spec.Path = "/book/:book_isbn" })},
+			kinds:    []string{CHANGE_PATH_CHANGED},
+			breaking: true,
+		},
+		{
+			name:     "same field at a path that existed before is not a move",
+			before:   []RouteSpec{book, with(func(spec *RouteSpec) { spec.Path = "/book/:book_isbn"; spec.Field = "Query.bookByIsbn" })},
+			after:    []RouteSpec{with(func(spec *RouteSpec) { spec.Path = "/book/:book_isbn" })},
+			kinds:    []string{CHANGE_ROUTE_REMOVED, CHANGE_ROUTE_REFIELDED},
+			breaking: true,
+		},
+		{
+			name:   "served by another field",
+			before: []RouteSpec{book},
+			after:  []RouteSpec{with(func(spec *RouteSpec) { spec.Field = "Query.bookByIsbn" })},
+			kinds:  []string{CHANGE_ROUTE_REFIELDED},
+		},
+		{
+			name:   "param renamed",
+			before: []RouteSpec{book},
+			after: []RouteSpec{with(func(spec *RouteSpec) {
+				delete(spec.QueryParams, "locale")
+				spec.QueryParams["language"] = ParamSpec{Type: "String"}
+			})},
+			kinds:    []string{CHANGE_PARAM_RENAMED},
+			breaking: true,
+		},
+		{
+			name:   "param of another type is removed, not renamed",
+			before: []RouteSpec{book},
+			after: []RouteSpec{with(func(spec *RouteSpec) {
+				delete(spec.QueryParams, "locale")
+				spec.QueryParams["edition"] = ParamSpec{Type: "Int"}
+			})},
+			kinds:    []string{CHANGE_PARAM_REMOVED, CHANGE_PARAM_ADDED},
+			breaking: true,
+		},
+		{
+			name:     "new required param",
+			before:   []RouteSpec{book},
+			after:    []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["edition"] = ParamSpec{Type: "Int", Required: true} })},
+			kinds:    []string{CHANGE_PARAM_REQUIRED},
+			breaking: true,
+		},
+		{
+			name:   "param now optional",
+			before: []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "String", Required: true} })},
+			after:  []RouteSpec{book},
+			kinds:  []string{CHANGE_PARAM_OPTIONAL},
+		},
+		{
+			name:   "param widened to a list",
+			before: []RouteSpec{book},
+			after:  []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "String", List: true} })},
+			kinds:  []string{CHANGE_PARAM_WIDENED},
+		},
+		{
+			name:     "param narrowed from a list",
+			before:   []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "String", List: true} })},
+			after:    []RouteSpec{book},
+			kinds:    []string{CHANGE_PARAM_NARROWED},
+			breaking: true,
+		},
+		{
+			name:   "Int widened to Float",
+			before: []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "Int"} })},
+			after:  []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "Float"} })},
+			kinds:  []string{CHANGE_PARAM_WIDENED},
+		},
+		{
+			name:     "String narrowed to Int",
+			before:   []RouteSpec{book},
+			after:    []RouteSpec{with(func(spec *RouteSpec) { spec.QueryParams["locale"] = ParamSpec{Type: "Int"} })},
+			kinds:    []string{CHANGE_PARAM_NARROWED},
+			breaking: true,
+		},
+		{
+			name:     "response field removed",
+			before:   []RouteSpec{book},
+			after:    []RouteSpec{with(func(spec *RouteSpec) { spec.Selections = []string{"isbn"} })},
+			kinds:    []string{CHANGE_FIELD_REMOVED},
+			breaking: true,
+		},
+		{
+			name:   "response field added",
+			before: []RouteSpec{book},
+			after:  []RouteSpec{with(func(spec *RouteSpec) { spec.Selections = append(spec.Selections, "year") })},
+			kinds:  []string{CHANGE_FIELD_ADDED},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := DiffSurfaces(tt.before, tt.after)
+			if len(changes) != len(tt.kinds) {
+				t.Fatalf("expected %v, got %v", tt.kinds, changes)
+			}
+			for i, change := range changes {
+				if change.Kind != tt.kinds[i] {
+					t.Errorf("expected %s, got %s: %s", tt.kinds[i], change.Kind, change.Detail)
+				}
+			}
+			if HasBreaking(changes) != tt.breaking {
+				t.Errorf("expected breaking %t, got %v", tt.breaking, changes)
+			}
+		})
+	}
+}
+
+func TestDiffSurfacesMovedTo(t *testing.T) {
+	before := []RouteSpec{{Method: "GET", Path: "/books/:book_isbn", Field: "Query.book"}}
+	after := []RouteSpec{
+		{Method: "GET", Path: "/books/:book_isbn/reviews", Field: "Book.reviews"},
+		{Method: "GET", Path: "/book/:book_isbn", Field: "Query.book"},
+	}
+	changes := DiffSurfaces(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("expected a move and an added route, got %v", changes)
+	}
+	if changes[0].Kind != CHANGE_PATH_CHANGED || changes[0].To != "/book/:book_isbn" {
+		t.Errorf("expected a move to /book/:book_isbn, got %+v", changes[0])
+	}
+	if changes[1].Kind != CHANGE_ROUTE_ADDED || changes[1].Path != "/books/:book_isbn/reviews" {
+		t.Errorf("expected /books/:book_isbn/reviews added, got %+v", changes[1])
+	}
+}
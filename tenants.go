@@ -0,0 +1,154 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	TENANT_FROM_HEADER    = "header"    // e.g. X-Tenant: acme
+	TENANT_FROM_SUBDOMAIN = "subdomain" // e.g. acme.api.example.com
+	TENANT_FROM_PATH      = "path"      // e.g. /acme/books, routes are served below the tenant
+
+	TENANT_PARAM = "gemini_tenant" // path param holding the tenant with TENANT_FROM_PATH
+)
+
+// TenantUpstream - where a tenant's requests go.
+type TenantUpstream struct {
+	Upstream string            `json:"upstream"`
+	Headers  map[string]string `json:"headers,omitempty"` // ${VAR} is expanded
+}
+
+// TenantConfig - the file passed with -tenants.
+type TenantConfig struct {
+	From    string                    `json:"from"`              // TENANT_FROM_*
+	Header  string                    `json:"header,omitempty"`  // header name with TENANT_FROM_HEADER, X-Tenant when empty
+	Domain  string                    `json:"domain,omitempty"`  // base domain with TENANT_FROM_SUBDOMAIN, e.g. api.example.com
+	Default string                    `json:"default,omitempty"` // tenant for requests naming none, they fail with 400 without it
+	Tenants map[string]TenantUpstream `json:"tenants"`
+}
+
+// TenantError - the request names no tenant or an unknown one.
+type TenantError struct {
+	Status  int
+	Message string
+}
+
+func (e *TenantError) Error() string {
+	return e.Message
+}
+
+// Tenants - picks the upstream of a request by its tenant.
+type Tenants struct {
+	TenantConfig
+	upstreams map[string]*Upstream
+}
+
+// ReadTenants - load and check the tenants config.
+func ReadTenants(path string) (*Tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tenants config %s: %s", path, err)
+	}
+	config := TenantConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("cannot parse tenants config %s: %s", path, err)
+	}
+	return NewTenants(config)
+}
+
+// NewTenants - build an upstream per tenant.
+func NewTenants(config TenantConfig) (*Tenants, error) {
+	switch config.From {
+	case TENANT_FROM_HEADER:
+		if config.Header == "" {
+			config.Header = "X-Tenant"
+		}
+	case TENANT_FROM_SUBDOMAIN:
+		if config.Domain == "" {
+			return nil, fmt.Errorf("tenants from subdomains need the base domain")
+		}
+		config.Domain = strings.ToLower(strings.Trim(config.Domain, "."))
+	case TENANT_FROM_PATH:
+	default:
+		return nil, fmt.Errorf("tenant must come from header, subdomain or path, got %q", config.From)
+	}
+	if len(config.Tenants) == 0 {
+		return nil, fmt.Errorf("no tenants configured")
+	}
+	if _, ok := config.Tenants[config.Default]; config.Default != "" && !ok {
+		return nil, fmt.Errorf("default tenant %s is not configured", config.Default)
+	}
+
+	tenants := &Tenants{TenantConfig: config, upstreams: make(map[string]*Upstream, len(config.Tenants))}
+	for name, tenant := range config.Tenants {
+		if tenant.Upstream == "" {
+			return nil, fmt.Errorf("tenant %s has no upstream", name)
+		}
+		tenants.upstreams[name] = NewUpstream(tenant.Upstream, expandHeaders(tenant.Headers))
+	}
+	return tenants, nil
+}
+
+// Tenant - the tenant a request names, empty when it names none. pathTenant
+// is the TENANT_PARAM path param.
+func (t *Tenants) Tenant(r *http.Request, pathTenant string) string {
+	switch t.From {
+	case TENANT_FROM_HEADER:
+		return strings.TrimSpace(r.Header.Get(t.Header))
+	case TENANT_FROM_SUBDOMAIN:
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		// acme.api.example.com, the bare base domain names no tenant
+		tenant := strings.TrimSuffix(strings.ToLower(host), "."+t.Domain)
+		if tenant == strings.ToLower(host) || strings.Contains(tenant, ".") {
+			return ""
+		}
+		return tenant
+	case TENANT_FROM_PATH:
+		return pathTenant
+	}
+	return ""
+}
+
+// Select - the upstream for a request, a TenantError when the tenant is
+// missing (400) or unknown (404).
+func (t *Tenants) Select(r *http.Request, pathTenant string) (string, *Upstream, error) {
+	name := t.Tenant(r, pathTenant)
+	if name == "" {
+		if t.Default == "" {
+			return "", nil, &TenantError{Status: 400, Message: t.missingMessage()}
+		}
+		name = t.Default
+	}
+	upstream, ok := t.upstreams[name]
+	if !ok {
+		return name, nil, &TenantError{Status: 404, Message: fmt.Sprintf("Unknown tenant %s.", name)}
+	}
+	return name, upstream, nil
+}
+
+func (t *Tenants) missingMessage() string {
+	switch t.From {
+	case TENANT_FROM_HEADER:
+		return fmt.Sprintf("Missing tenant, set the %s header.", t.Header)
+	case TENANT_FROM_SUBDOMAIN:
+		return "Missing tenant, use a tenant subdomain."
+	}
+	return "Missing tenant."
+}
+
+// Routes - with tenants in the path every route is served below the tenant,
+// e.g. /:gemini_tenant/books.
+func (t *Tenants) Routes(routeMap map[string]*GetMethod) map[string]*GetMethod {
+	if t == nil || t.From != TENANT_FROM_PATH {
+		return routeMap
+	}
+	return MountRoutes(routeMap, "/:"+TENANT_PARAM)
+}
@@ -0,0 +1,120 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Upstream - the GraphQL endpoint REST requests are translated for.
+type Upstream struct {
+	URL     string
+	Headers http.Header
+	Client  *http.Client
+}
+
+type GQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []GQLError             `json:"errors"`
+}
+
+// NewUpstream - upstream with a default client, nil if url is empty.
+func NewUpstream(url string, headers http.Header) *Upstream {
+	if url == "" {
+		return nil
+	}
+	return &Upstream{
+		URL:     url,
+		Headers: headers,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Execute - send a GraphQL request to the upstream, or to url when given
+// (e.g. a subgraph for _entities), and decode the response.
+func (u *Upstream) Execute(url, query, opName string, variables map[string]interface{}) (*GQLResponse, error) {
+	postRequest, err := u.NewRequest(url, query, opName, variables)
+	if err != nil {
+		return nil, err
+	}
+	return u.Do(postRequest)
+}
+
+// NewRequest - the HTTP request Execute sends, with the upstream's headers.
+func (u *Upstream) NewRequest(url, query, opName string, variables map[string]interface{}) (*http.Request, error) {
+
+	if url == "" {
+		url = u.URL
+	}
+
+	var q = GQLQuery{
+		Variables:     variables,
+		Query:         query,
+		OperationName: opName,
+	}
+
+	body, err := json.Marshal(q)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode request: %s", err)
+	}
+
+	postRequest, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("could create request %s", err)
+	}
+
+	postRequest.Header.Set("Accept", "application/json")
+	postRequest.Header.Set("Content-Type", "application/json")
+	for name, values := range u.Headers {
+		for _, value := range values {
+			postRequest.Header.Add(name, value)
+		}
+	}
+	return postRequest, nil
+}
+
+// Do - send a request built by NewRequest and decode the response.
+func (u *Upstream) Do(postRequest *http.Request) (*GQLResponse, error) {
+	resp, err := u.Client.Do(postRequest)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach upstream %s: %s", postRequest.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		upstreamErr := &UpstreamError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		// GraphQL servers answer e.g. invalid variables with 400 and errors
+		result := &GQLResponse{}
+		if json.Unmarshal(respBody, result) == nil {
+			upstreamErr.Errors = result.Errors
+		}
+		return nil, upstreamErr
+	}
+
+	result := &GQLResponse{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode upstream response: %s", err)
+	}
+	return result, nil
+}
+
+// UpstreamError - the upstream answered with a non-200 status, Errors holds
+// the GraphQL errors of the body if it had any.
+type UpstreamError struct {
+	StatusCode int
+	Errors     []GQLError
+	Body       string
+}
+
+func (e *UpstreamError) Error() string {
+	body := e.Body
+	if len(body) > 4096 {
+		body = body[:4096]
+	}
+	return fmt.Sprintf("upstream responded with HTTP %d: %s", e.StatusCode, body)
+}
@@ -1,4 +1,4 @@
-package main
+package gemini
 
 import (
 	"regexp"
@@ -21,3 +21,16 @@ func IsScalar(typeName string) bool {
 	}
 	return false
 }
+
+// Pluralize - naive English plural of a snake_case resource name.
+func Pluralize(str string) string {
+	switch {
+	case strings.HasSuffix(str, "s"), strings.HasSuffix(str, "x"),
+		strings.HasSuffix(str, "ch"), strings.HasSuffix(str, "sh"):
+		return str + "es"
+	case strings.HasSuffix(str, "y") && !strings.HasSuffix(str, "ay") &&
+		!strings.HasSuffix(str, "ey") && !strings.HasSuffix(str, "oy"):
+		return str[:len(str)-1] + "ies"
+	}
+	return str + "s"
+}